@@ -3,75 +3,190 @@ package snet
 import (
 	"crypto/tls"
 	"crypto/x509"
-	"log"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
 	"os"
 )
 
 var (
 	serverAuthConfig *tls.Config
 	clientAuthConfig *tls.Config
+	// clientAuthForHost 按拨号地址中的主机生成客户端配置, 设置时优先于clientAuthConfig
+	clientAuthForHost func(host string) *tls.Config
 )
 
+// clientTLSConfig 拨号addr使用的客户端TLS配置, 未启用TLS时为nil
+func clientTLSConfig(addr string) *tls.Config {
+	if clientAuthForHost != nil {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		return clientAuthForHost(host)
+	}
+	return clientAuthConfig
+}
+
+// TLSOption TLS配置选项
+type TLSOption func(cfg *tls.Config)
+
+// WithMinVersion 最低TLS版本, 默认tls.VersionTLS12
+func WithMinVersion(version uint16) TLSOption {
+	return func(cfg *tls.Config) {
+		cfg.MinVersion = version
+	}
+}
+
+// WithCipherSuites 允许的密码套件, 只对TLS 1.2及以下版本生效
+func WithCipherSuites(suites ...uint16) TLSOption {
+	return func(cfg *tls.Config) {
+		cfg.CipherSuites = suites
+	}
+}
+
+// WithServerName 校验服务端证书使用的名称, 默认为拨号地址中的主机
+func WithServerName(name string) TLSOption {
+	return func(cfg *tls.Config) {
+		cfg.ServerName = name
+	}
+}
+
+// WithALPN 应用层协议协商支持的协议, 按优先级排列
+func WithALPN(protocols ...string) TLSOption {
+	return func(cfg *tls.Config) {
+		cfg.NextProtos = protocols
+	}
+}
+
+// applyTLSOptions 应用选项
+func applyTLSOptions(cfg *tls.Config, opts []TLSOption) *tls.Config {
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// load 从文件加载证书和CA池
 func load(cafile, certfile, keyfile string) (tls.Certificate, *x509.CertPool, error) {
-	cert, err := tls.LoadX509KeyPair(certfile, keyfile)
+	caPEM, err := readPEMFile("CA", cafile)
 	if err != nil {
-		log.Fatal(err)
 		return tls.Certificate{}, nil, err
 	}
-
-	caCert, err := os.ReadFile(cafile)
+	certPEM, err := readPEMFile("certificate", certfile)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	keyPEM, err := readPEMFile("private key", keyfile)
 	if err != nil {
-		log.Fatal(err)
 		return tls.Certificate{}, nil, err
 	}
+	return loadPEM(caPEM, certPEM, keyPEM)
+}
 
+// readPEMFile 读取文件, 文件不存在时返回ErrCertFileNotFound, 其他错误(如权限不足)原样包装
+func readPEMFile(what, file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("snet: %s %s: %w", what, file, ErrCertFileNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("snet: read %s: %w", what, err)
+	}
+	return data, nil
+}
+
+// loadPEM 从PEM数据加载证书和CA池
+func loadPEM(caPEM, certPEM, keyPEM []byte) (tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("snet: load key pair: %w", err)
+	}
 	certPool := x509.NewCertPool()
-	certPool.AppendCertsFromPEM(caCert)
+	if !certPool.AppendCertsFromPEM(caPEM) {
+		return tls.Certificate{}, nil, fmt.Errorf("snet: no CA certificate found in PEM data: %w", ErrCertInvalid)
+	}
 	return cert, certPool, nil
 }
 
-func fileExists(filename string) bool {
-	if _, err := os.Stat(filename); err == nil {
-		return true
-	} else if os.IsNotExist(err) {
-		return false
-	} else {
-		// 其他错误（如权限问题）
-		return false
-	}
+// serverConfig 服务器端双向认证配置
+func serverConfig(cert tls.Certificate, certPool *x509.CertPool, opts []TLSOption) *tls.Config {
+	return applyTLSOptions(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    certPool,
+		MinVersion:   tls.VersionTLS12,
+	}, opts)
+}
+
+// clientConfig 客户端双向认证配置
+func clientConfig(cert tls.Certificate, certPool *x509.CertPool, opts []TLSOption) *tls.Config {
+	return applyTLSOptions(&tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		RootCAs:            certPool,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: false,
+	}, opts)
 }
 
 // 设置服务器端认证配置
-func SetServerAuth(caFile, crtFile, keyFile string) error {
-	if !fileExists(crtFile) || !fileExists(keyFile) || !fileExists(caFile) {
-		return ErrCertFileNotFound
-	}
+func SetServerAuth(caFile, crtFile, keyFile string, opts ...TLSOption) error {
 	cert, certPool, err := load(caFile, crtFile, keyFile)
 	if err != nil {
 		return err
 	}
-	serverAuthConfig = &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		ClientAuth:   tls.RequireAndVerifyClientCert,
-		ClientCAs:    certPool,
-	}
+	serverAuthConfig = serverConfig(cert, certPool, opts)
 	return nil
 }
 
 // 设置客户端认证配置
-func SetClientAuth(caFile, crtFile, keyFile string) error {
-	if !fileExists(crtFile) || !fileExists(keyFile) || !fileExists(caFile) {
-		return ErrCertFileNotFound
-	}
+func SetClientAuth(caFile, crtFile, keyFile string, opts ...TLSOption) error {
 	cert, certPool, err := load(caFile, crtFile, keyFile)
 	if err != nil {
 		return err
 	}
-	clientAuthConfig = &tls.Config{
-		Certificates:       []tls.Certificate{cert},
-		RootCAs:            certPool,
-		MinVersion:         tls.VersionTLS12,
-		InsecureSkipVerify: false,
+	clientAuthConfig = clientConfig(cert, certPool, opts)
+	clientAuthForHost = nil
+	return nil
+}
+
+// SetServerAuthPEM 以PEM数据设置服务器端认证配置, 适用于证书保存在密钥服务或环境变量中的场景
+func SetServerAuthPEM(caPEM, certPEM, keyPEM []byte, opts ...TLSOption) error {
+	cert, certPool, err := loadPEM(caPEM, certPEM, keyPEM)
+	if err != nil {
+		return err
 	}
+	serverAuthConfig = serverConfig(cert, certPool, opts)
 	return nil
 }
+
+// SetClientAuthPEM 以PEM数据设置客户端认证配置
+func SetClientAuthPEM(caPEM, certPEM, keyPEM []byte, opts ...TLSOption) error {
+	cert, certPool, err := loadPEM(caPEM, certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	clientAuthConfig = clientConfig(cert, certPool, opts)
+	clientAuthForHost = nil
+	return nil
+}
+
+// SetServerTLSConfig 直接设置服务器端TLS配置, cfg会被复制, 传入nil关闭TLS
+func SetServerTLSConfig(cfg *tls.Config, opts ...TLSOption) {
+	if cfg == nil {
+		serverAuthConfig = nil
+		return
+	}
+	serverAuthConfig = applyTLSOptions(cfg.Clone(), opts)
+}
+
+// SetClientTLSConfig 直接设置客户端TLS配置, cfg会被复制, 传入nil关闭TLS
+func SetClientTLSConfig(cfg *tls.Config, opts ...TLSOption) {
+	clientAuthForHost = nil
+	if cfg == nil {
+		clientAuthConfig = nil
+		return
+	}
+	clientAuthConfig = applyTLSOptions(cfg.Clone(), opts)
+}
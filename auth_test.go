@@ -0,0 +1,136 @@
+package snet
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/laazua/snet/certgen"
+)
+
+// credentials CA及签发的服务端、客户端证书的PEM数据
+type credentials struct {
+	ca, serverCert, serverKey, clientCert, clientKey []byte
+}
+
+func newCredentials(t *testing.T) credentials {
+	t.Helper()
+	ca, err := certgen.NewCA(certgen.Options{CommonName: "test ca"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := ca.IssueServer(certgen.Options{CommonName: "server", Hosts: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := ca.IssueClient(certgen.Options{CommonName: "client"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds := credentials{ca: ca.CertPEM(), serverCert: server.CertPEM(), clientCert: client.CertPEM()}
+	if creds.serverKey, err = server.KeyPEM(); err != nil {
+		t.Fatal(err)
+	}
+	if creds.clientKey, err = client.KeyPEM(); err != nil {
+		t.Fatal(err)
+	}
+	return creds
+}
+
+// resetTLS 测试结束时恢复为明文连接
+func resetTLS(t *testing.T) {
+	t.Cleanup(func() {
+		SetServerTLSConfig(nil)
+		SetClientTLSConfig(nil)
+	})
+}
+
+func TestAuthPEM(t *testing.T) {
+	creds := newCredentials(t)
+	resetTLS(t)
+	if err := SetServerAuthPEM(creds.ca, creds.serverCert, creds.serverKey, WithALPN("snet")); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetClientAuthPEM(creds.ca, creds.clientCert, creds.clientKey, WithALPN("snet"), WithMinVersion(tls.VersionTLS13)); err != nil {
+		t.Fatal(err)
+	}
+
+	c := dialClient(t, tlsServer(t))
+	peer := c.PeerIdentity()
+	if peer == nil || peer.CommonName != "server" {
+		t.Fatalf("server identity %+v", peer)
+	}
+	if peer.Protocol != "snet" || peer.TLSVersion != tls.VersionTLS13 {
+		t.Fatalf("negotiated protocol %q version %x", peer.Protocol, peer.TLSVersion)
+	}
+}
+
+func TestAuthFiles(t *testing.T) {
+	creds := newCredentials(t)
+	resetTLS(t)
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"ca.crt": creds.ca, "server.crt": creds.serverCert, "server.key": creds.serverKey,
+		"client.crt": creds.clientCert, "client.key": creds.clientKey,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	if err := SetServerAuth(path("ca.crt"), path("server.crt"), path("server.key")); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetClientAuth(path("ca.crt"), path("client.crt"), path("client.key"), WithServerName("127.0.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	c := dialClient(t, tlsServer(t))
+	if c.PeerIdentity() == nil {
+		t.Fatal("connection is not TLS")
+	}
+
+	// 加载失败返回错误, 不退出进程
+	if err := SetServerAuth(path("missing.crt"), path("server.crt"), path("server.key")); !errors.Is(err, ErrCertFileNotFound) {
+		t.Fatalf("missing file: %v", err)
+	}
+	// 其他读取错误(此处为ENOTDIR)不报告为文件不存在
+	err := SetServerAuth(filepath.Join(path("ca.crt"), "x"), path("server.crt"), path("server.key"))
+	if err == nil || errors.Is(err, ErrCertFileNotFound) {
+		t.Fatalf("unreadable file: %v", err)
+	}
+}
+
+func TestAuthPEMErrors(t *testing.T) {
+	creds := newCredentials(t)
+	resetTLS(t)
+
+	if err := SetServerAuthPEM([]byte("no ca"), creds.serverCert, creds.serverKey); !errors.Is(err, ErrCertInvalid) {
+		t.Fatalf("bad CA: %v", err)
+	}
+	if err := SetServerAuthPEM(creds.ca, creds.serverCert, creds.clientKey); err == nil {
+		t.Fatal("mismatched key accepted")
+	}
+	if serverAuthConfig != nil {
+		t.Fatal("failed load changed the server configuration")
+	}
+}
+
+func TestSetTLSConfigClones(t *testing.T) {
+	resetTLS(t)
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	SetClientTLSConfig(cfg, WithServerName("example.com"))
+	cfg.MinVersion = tls.VersionTLS10
+
+	got := clientTLSConfig("127.0.0.1:1")
+	if got == cfg || got.MinVersion != tls.VersionTLS12 || got.ServerName != "example.com" {
+		t.Fatalf("client config %+v", got)
+	}
+	SetClientTLSConfig(nil)
+	if clientTLSConfig("127.0.0.1:1") != nil {
+		t.Fatal("TLS not disabled")
+	}
+}
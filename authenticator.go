@@ -0,0 +1,263 @@
+package snet
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Principal 认证通过的身份
+type Principal struct {
+	Name      string         `json:"sub"`              // 身份标识, 认证后作为会话的用户标识
+	Roles     []string       `json:"roles,omitempty"`  // 角色
+	Claims    map[string]any `json:"claims,omitempty"` // 其他声明
+	ExpiresAt time.Time      `json:"-"`                // 过期时间, 零值表示不过期
+}
+
+// expired 身份是否已过期
+func (p *Principal) expired(now time.Time) bool {
+	return !p.ExpiresAt.IsZero() && now.After(p.ExpiresAt)
+}
+
+// HasRole 是否拥有角色
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator 认证器, 校验PacketTypeLogin/PacketTypeAuth数据包携带的凭证
+type Authenticator interface {
+	Authenticate(ctx context.Context, conn *Conn, credentials []byte) (*Principal, error)
+}
+
+// AuthenticatorFunc 认证器函数类型
+type AuthenticatorFunc func(ctx context.Context, conn *Conn, credentials []byte) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, conn *Conn, credentials []byte) (*Principal, error) {
+	return f(ctx, conn, credentials)
+}
+
+// staticTokenAuthenticator 静态令牌认证
+type staticTokenAuthenticator struct {
+	tokens map[string]*Principal
+}
+
+// NewStaticTokenAuthenticator 创建静态令牌认证器, tokens为令牌到身份的映射
+func NewStaticTokenAuthenticator(tokens map[string]*Principal) Authenticator {
+	copied := make(map[string]*Principal, len(tokens))
+	for token, principal := range tokens {
+		copied[token] = principal
+	}
+	return &staticTokenAuthenticator{tokens: copied}
+}
+
+func (a *staticTokenAuthenticator) Authenticate(ctx context.Context, conn *Conn, credentials []byte) (*Principal, error) {
+	for token, principal := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), credentials) == 1 {
+			copied := *principal
+			return &copied, nil
+		}
+	}
+	return nil, ErrAuthFailed
+}
+
+// HMACTokenAuthenticator HMAC-SHA256签名令牌认证,
+// 令牌格式为 base64url(声明JSON) + "." + base64url(签名)
+type HMACTokenAuthenticator struct {
+	secret []byte
+}
+
+// hmacClaims 令牌中的声明
+type hmacClaims struct {
+	Principal
+	Exp int64 `json:"exp,omitempty"`
+}
+
+// NewHMACTokenAuthenticator 创建HMAC令牌认证器
+func NewHMACTokenAuthenticator(secret []byte) *HMACTokenAuthenticator {
+	return &HMACTokenAuthenticator{secret: append([]byte(nil), secret...)}
+}
+
+// Sign 为身份签发令牌, ttl<=0表示不过期
+func (a *HMACTokenAuthenticator) Sign(principal *Principal, ttl time.Duration) (string, error) {
+	claims := hmacClaims{Principal: *principal}
+	if ttl > 0 {
+		claims.Exp = time.Now().Add(ttl).Unix()
+	}
+	payload, err := json.Marshal(&claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(a.sign(encoded)), nil
+}
+
+// sign 计算签名
+func (a *HMACTokenAuthenticator) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func (a *HMACTokenAuthenticator) Authenticate(ctx context.Context, conn *Conn, credentials []byte) (*Principal, error) {
+	payload, sig, ok := strings.Cut(string(credentials), ".")
+	if !ok {
+		return nil, ErrAuthFailed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(signature, a.sign(payload)) {
+		return nil, ErrAuthFailed
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+
+	var claims hmacClaims
+	if err := json.Unmarshal(data, &claims); err != nil || claims.Name == "" {
+		return nil, ErrAuthFailed
+	}
+	principal := claims.Principal
+	if claims.Exp > 0 {
+		principal.ExpiresAt = time.Unix(claims.Exp, 0)
+		if principal.expired(time.Now()) {
+			return nil, ErrAuthExpired
+		}
+	}
+	return &principal, nil
+}
+
+// AuthConfig 认证配置
+type AuthConfig struct {
+	GracePeriod time.Duration // 连接建立、登出或身份过期后完成认证的时限, 超时断开, 默认10秒
+	AllowTypes  []PacketType  // 认证前额外允许的包类型, 心跳、握手、登录和认证包总是允许
+}
+
+// authGate 服务端认证关卡
+type authGate struct {
+	auth  Authenticator
+	grace time.Duration
+	allow map[PacketType]bool
+	hooks *lifecycleHooks // 服务器的生命周期回调
+}
+
+func newAuthGate(auth Authenticator, cfg AuthConfig) *authGate {
+	gate := &authGate{
+		auth:  auth,
+		grace: cfg.GracePeriod,
+		allow: map[PacketType]bool{
+			PacketTypeHeartbeat: true,
+			PacketTypeHandshake: true,
+			PacketTypeLogin:     true,
+			PacketTypeAuth:      true,
+		},
+	}
+	if gate.grace <= 0 {
+		gate.grace = 10 * time.Second
+	}
+	for _, packetType := range cfg.AllowTypes {
+		gate.allow[packetType] = true
+	}
+	return gate
+}
+
+// watch 宽限期内未完成认证则断开连接
+func (g *authGate) watch(conn *Conn) {
+	timer := time.AfterFunc(g.grace, func() {
+		if conn.session.Principal() == nil && !conn.isClosed() {
+			conn.logger.Info("authentication timeout", slog.Duration("grace", g.grace))
+			conn.SendPacket(NewPacket(PacketTypeError, []byte(ErrAuthRequired.Error()), 0))
+			conn.Disconnect(CloseAuthTimeout)
+		}
+	})
+	conn.authTimer = timer
+	go func() {
+		<-conn.closed
+		timer.Stop()
+	}()
+}
+
+// rearm 登出或身份过期后重新开始宽限期, 期间未再次认证则断开连接
+func (g *authGate) rearm(conn *Conn) {
+	if conn.authTimer != nil && !conn.isClosed() {
+		conn.authTimer.Reset(g.grace)
+	}
+}
+
+// admit 未认证或身份已过期的连接只允许白名单中的包类型
+func (g *authGate) admit(conn *Conn, packet *Packet) bool {
+	if principal := conn.session.Principal(); principal != nil {
+		if !principal.expired(time.Now()) {
+			return true
+		}
+		conn.session.SetPrincipal(nil)
+		g.rearm(conn)
+	}
+	return g.allow[packet.Header.Type]
+}
+
+// owns 是否由认证关卡处理的包类型
+func (g *authGate) owns(packetType PacketType) bool {
+	return packetType == PacketTypeLogin || packetType == PacketTypeAuth || packetType == PacketTypeLogout
+}
+
+// Handle 处理登录、认证和登出数据包
+func (g *authGate) Handle(conn *Conn, packet *Packet) {
+	switch packet.Header.Type {
+	case PacketTypeLogin, PacketTypeAuth:
+		ctx := context.WithValue(context.Background(), connContextKey{}, conn)
+		principal, err := g.auth.Authenticate(ctx, conn, packet.Data)
+		if err == nil && principal == nil {
+			err = ErrAuthFailed
+		}
+		if err != nil {
+			conn.logger.Info("authentication failed", append(packetAttrs(packet), slog.Any("error", err))...)
+			if !errors.Is(err, ErrAuthExpired) {
+				err = ErrAuthFailed
+			}
+			conn.SendPacket(NewPacket(PacketTypeError, []byte(err.Error()), packet.Header.Seq))
+			return
+		}
+		conn.session.SetPrincipal(principal)
+		conn.logger.Debug("authenticated", slog.String("principal", principal.Name))
+		conn.SendPacket(NewPacket(PacketTypeAck, []byte(principal.Name), packet.Header.Seq))
+		if g.hooks != nil {
+			g.hooks.authenticated(conn, principal)
+		}
+	case PacketTypeLogout:
+		conn.session.SetPrincipal(nil)
+		g.rearm(conn)
+		conn.SendPacket(NewPacket(PacketTypeAck, nil, packet.Header.Seq))
+	}
+}
+
+// SetAuthenticator 启用认证: 连接需在宽限期内通过PacketTypeLogin或PacketTypeAuth完成认证,
+// 此前只能发送白名单中的包类型. 启用后登录、认证和登出包由认证器处理, 不再交给handler
+func (s *Server) SetAuthenticator(auth Authenticator, cfg AuthConfig) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authGate = newAuthGate(auth, cfg)
+	s.authGate.hooks = &s.hooks
+	return s
+}
+
+// Login 以凭证登录, 凭证的格式由服务端的认证器决定
+func (c *Client) Login(ctx context.Context, credentials []byte) error {
+	return c.requestAck(ctx, PacketTypeLogin, credentials)
+}
+
+// Logout 登出
+func (c *Client) Logout(ctx context.Context) error {
+	return c.requestAck(ctx, PacketTypeLogout, nil)
+}
@@ -0,0 +1,126 @@
+package snet
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// authServer 启用静态令牌认证的服务器, Chat包原样返回
+func authServer(t *testing.T, grace time.Duration) string {
+	t.Helper()
+	s := NewServer("")
+	s.SetAuthenticator(NewStaticTokenAuthenticator(map[string]*Principal{
+		"secret": {Name: "alice"},
+	}), AuthConfig{GracePeriod: grace})
+	s.AddHandlerFunc(PacketTypeChat, func(conn *Conn, packet *Packet) {
+		conn.SendPacket(NewPacket(PacketTypeChat, packet.Data, packet.Header.Seq))
+	})
+	return startServer(t, s)
+}
+
+// closeReasons 客户端连接关闭时收到的原因
+func closeReasons(c *Client) chan CloseReason {
+	reasons := make(chan CloseReason, 1)
+	c.OnClose(func(conn *Conn, reason CloseReason) { reasons <- reason })
+	return reasons
+}
+
+func TestAuthRequiredBeforeLogin(t *testing.T) {
+	c := dialClient(t, authServer(t, time.Minute))
+	ctx := context.Background()
+
+	packet, err := c.Request(ctx, PacketTypeChat, []byte("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet.Header.Type != PacketTypeError || string(packet.Data) != ErrAuthRequired.Error() {
+		t.Fatalf("before login got type %d %q, want auth required", packet.Header.Type, packet.Data)
+	}
+	if err := c.Login(ctx, []byte("wrong")); err == nil || err.Error() != ErrAuthFailed.Error() {
+		t.Fatalf("login with bad token: %v", err)
+	}
+	if err := c.Login(ctx, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	packet, err = c.Request(ctx, PacketTypeChat, []byte("hi"))
+	if err != nil || packet.Header.Type != PacketTypeChat {
+		t.Fatalf("after login: %v %v", packet, err)
+	}
+}
+
+func TestAuthTimeout(t *testing.T) {
+	c := NewClient(authServer(t, 50*time.Millisecond))
+	reasons := closeReasons(c)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	select {
+	case reason := <-reasons:
+		if reason != CloseAuthTimeout {
+			t.Fatalf("closed with %v, want %v", reason, CloseAuthTimeout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("unauthenticated connection not closed")
+	}
+}
+
+func TestAuthGraceRestartsAfterLogout(t *testing.T) {
+	const grace = 100 * time.Millisecond
+	c := NewClient(authServer(t, grace))
+	reasons := closeReasons(c)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.Login(ctx, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	// 原宽限期结束后登出, 连接需在新的宽限期内重新认证
+	time.Sleep(2 * grace)
+	if err := c.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case reason := <-reasons:
+		if reason != CloseAuthTimeout {
+			t.Fatalf("closed with %v, want %v", reason, CloseAuthTimeout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection stayed open after logout without re-authenticating")
+	}
+}
+
+func TestHMACTokenAuthenticator(t *testing.T) {
+	auth := NewHMACTokenAuthenticator([]byte("key"))
+	token, err := auth.Sign(&Principal{Name: "bob", Roles: []string{"admin"}}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, err := auth.Authenticate(context.Background(), nil, []byte(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.Name != "bob" || !principal.HasRole("admin") {
+		t.Fatalf("got principal %+v", principal)
+	}
+
+	payload, _, _ := strings.Cut(token, ".")
+	if _, err := auth.Authenticate(context.Background(), nil, []byte(payload+".AAAA")); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("tampered token: %v, want ErrAuthFailed", err)
+	}
+	other := NewHMACTokenAuthenticator([]byte("other"))
+	if _, err := other.Authenticate(context.Background(), nil, []byte(token)); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("token signed with another key: %v, want ErrAuthFailed", err)
+	}
+	forever, _ := auth.Sign(&Principal{Name: "bob"}, -time.Hour)
+	if _, err := auth.Authenticate(context.Background(), nil, []byte(forever)); err != nil {
+		t.Fatalf("ttl<=0 should not expire: %v", err)
+	}
+}
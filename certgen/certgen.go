@@ -0,0 +1,253 @@
+// Package certgen 使用crypto/x509生成CA、服务端和客户端证书, 不依赖openssl.
+// 生成的PEM文件可直接用于snet.SetServerAuth和snet.SetClientAuth
+package certgen
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// KeyType 私钥类型
+type KeyType string
+
+const (
+	KeyECDSA   KeyType = "ecdsa"   // ECDSA P-256
+	KeyEd25519 KeyType = "ed25519" // Ed25519
+	KeyRSA     KeyType = "rsa"     // RSA, 位数由Options.RSABits指定
+)
+
+var (
+	ErrKeyTypeInvalid = errors.New("certgen: invalid key type")
+	ErrNotCA          = errors.New("certgen: certificate is not a CA")
+	ErrNoPEM          = errors.New("certgen: no PEM data found")
+)
+
+// Options 证书选项
+type Options struct {
+	CommonName   string        // 主题CN
+	Organization []string      // 主题O
+	Hosts        []string      // SAN: IP、URI(含"://")、邮箱(含"@"), 其余视为DNS名称
+	KeyType      KeyType       // 私钥类型, 默认ECDSA
+	RSABits      int           // RSA位数, 默认2048
+	Validity     time.Duration // 有效期, 默认365天
+}
+
+// Certificate 证书及其私钥
+type Certificate struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// GenerateKey 生成私钥, bits只对RSA有效
+func GenerateKey(keyType KeyType, bits int) (crypto.Signer, error) {
+	switch keyType {
+	case KeyECDSA, "":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case KeyRSA:
+		if bits <= 0 {
+			bits = 2048
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrKeyTypeInvalid, keyType)
+}
+
+// NewCA 创建自签名CA证书
+func NewCA(opts Options) (*Certificate, error) {
+	tmpl, key, err := template(opts)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	return create(tmpl, tmpl, key.Public(), key, key)
+}
+
+// IssueServer 签发服务端证书, Hosts应包含客户端连接时使用的域名或IP
+func (ca *Certificate) IssueServer(opts Options) (*Certificate, error) {
+	return ca.issue(opts, x509.ExtKeyUsageServerAuth)
+}
+
+// IssueClient 签发客户端证书
+func (ca *Certificate) IssueClient(opts Options) (*Certificate, error) {
+	return ca.issue(opts, x509.ExtKeyUsageClientAuth)
+}
+
+// issue 以CA签发证书
+func (ca *Certificate) issue(opts Options, usage x509.ExtKeyUsage) (*Certificate, error) {
+	if !ca.Cert.IsCA {
+		return nil, ErrNotCA
+	}
+	tmpl, key, err := template(opts)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		tmpl.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+	if tmpl.NotAfter.After(ca.Cert.NotAfter) {
+		tmpl.NotAfter = ca.Cert.NotAfter
+	}
+	return create(tmpl, ca.Cert, key.Public(), ca.Key, key)
+}
+
+// template 按选项生成证书模板和私钥
+func template(opts Options) (*x509.Certificate, crypto.Signer, error) {
+	key, err := GenerateKey(opts.KeyType, opts.RSABits)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	validity := opts.Validity
+	if validity <= 0 {
+		validity = 365 * 24 * time.Hour
+	}
+	now := time.Now()
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   opts.CommonName,
+			Organization: opts.Organization,
+		},
+		NotBefore: now.Add(-5 * time.Minute), // 容忍时钟偏差
+		NotAfter:  now.Add(validity),
+	}
+	for _, host := range opts.Hosts {
+		host = strings.TrimSpace(host)
+		switch {
+		case host == "":
+		case net.ParseIP(host) != nil:
+			tmpl.IPAddresses = append(tmpl.IPAddresses, net.ParseIP(host))
+		case strings.Contains(host, "://"):
+			uri, err := url.Parse(host)
+			if err != nil {
+				return nil, nil, fmt.Errorf("certgen: invalid URI %q: %w", host, err)
+			}
+			tmpl.URIs = append(tmpl.URIs, uri)
+		case strings.Contains(host, "@"):
+			tmpl.EmailAddresses = append(tmpl.EmailAddresses, host)
+		default:
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+	return tmpl, key, nil
+}
+
+// create 签名并解析证书
+func create(tmpl, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer, key crypto.Signer) (*Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, signer)
+	if err != nil {
+		return nil, fmt.Errorf("certgen: create certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("certgen: parse certificate: %w", err)
+	}
+	return &Certificate{Cert: cert, Key: key}, nil
+}
+
+// CertPEM PEM编码的证书
+func (c *Certificate) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Cert.Raw})
+}
+
+// KeyPEM PEM编码的PKCS#8私钥
+func (c *Certificate) KeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(c.Key)
+	if err != nil {
+		return nil, fmt.Errorf("certgen: marshal private key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// WriteFiles 写出证书和私钥文件, 私钥文件权限为0600
+func (c *Certificate) WriteFiles(certFile, keyFile string) error {
+	keyPEM, err := c.KeyPEM()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(certFile, c.CertPEM(), 0644); err != nil {
+		return fmt.Errorf("certgen: %w", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return fmt.Errorf("certgen: %w", err)
+	}
+	return nil
+}
+
+// LoadCA 从文件加载已有的CA证书和私钥, 用于继续签发证书
+func LoadCA(certFile, keyFile string) (*Certificate, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("certgen: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("certgen: %w", err)
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, ErrNoPEM
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("certgen: parse certificate: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, ErrNotCA
+	}
+	key, err := parseKey(keyBlock)
+	if err != nil {
+		return nil, err
+	}
+	return &Certificate{Cert: cert, Key: key}, nil
+}
+
+// parseKey 解析PKCS#8、PKCS#1或SEC 1格式的私钥
+func parseKey(block *pem.Block) (crypto.Signer, error) {
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("certgen: parse private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, ErrKeyTypeInvalid
+	}
+	return signer, nil
+}
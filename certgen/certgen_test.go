@@ -0,0 +1,127 @@
+package certgen
+
+import (
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIssueAndVerify(t *testing.T) {
+	for _, keyType := range []KeyType{KeyECDSA, KeyEd25519, KeyRSA} {
+		ca, err := NewCA(Options{CommonName: "ca", KeyType: keyType})
+		if err != nil {
+			t.Fatalf("%s: %v", keyType, err)
+		}
+		server, err := ca.IssueServer(Options{CommonName: "server", KeyType: keyType, Hosts: []string{"example.com", "127.0.0.1"}})
+		if err != nil {
+			t.Fatalf("%s: %v", keyType, err)
+		}
+		client, err := ca.IssueClient(Options{CommonName: "client", KeyType: keyType})
+		if err != nil {
+			t.Fatalf("%s: %v", keyType, err)
+		}
+
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.Cert)
+		if _, err := server.Cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "example.com"}); err != nil {
+			t.Fatalf("%s: server certificate: %v", keyType, err)
+		}
+		if _, err := server.Cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: "127.0.0.1"}); err != nil {
+			t.Fatalf("%s: server certificate by IP: %v", keyType, err)
+		}
+		usage := []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		if _, err := client.Cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: usage}); err != nil {
+			t.Fatalf("%s: client certificate: %v", keyType, err)
+		}
+		// 服务端证书不能用于客户端认证
+		if _, err := server.Cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: usage}); err == nil {
+			t.Fatalf("%s: server certificate accepted for client auth", keyType)
+		}
+	}
+}
+
+func TestHosts(t *testing.T) {
+	ca, err := NewCA(Options{CommonName: "ca"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ca.IssueServer(Options{Hosts: []string{"a.example", " 10.0.0.1 ", "ops@example.com", "spiffe://example.org/a", ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cert.Cert
+	if len(c.DNSNames) != 1 || len(c.IPAddresses) != 1 || len(c.EmailAddresses) != 1 || len(c.URIs) != 1 {
+		t.Fatalf("SANs: dns %v ip %v email %v uri %v", c.DNSNames, c.IPAddresses, c.EmailAddresses, c.URIs)
+	}
+	if _, err := ca.IssueServer(Options{Hosts: []string{"bad://%zz"}}); err == nil {
+		t.Fatal("invalid URI accepted")
+	}
+}
+
+func TestValidityCappedByCA(t *testing.T) {
+	ca, err := NewCA(Options{CommonName: "ca", Validity: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ca.IssueClient(Options{Validity: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Cert.NotAfter.After(ca.Cert.NotAfter) {
+		t.Fatalf("certificate expires %v after the CA %v", cert.Cert.NotAfter, ca.Cert.NotAfter)
+	}
+}
+
+func TestLoadCA(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := NewCA(Options{CommonName: "ca"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	if err := ca.WriteFiles(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("key file mode %v, %v", info.Mode(), err)
+	}
+
+	loaded, err := LoadCA(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := loaded.IssueClient(Options{CommonName: "client"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Cert.CheckSignatureFrom(ca.Cert); err != nil {
+		t.Fatalf("issued by loaded CA: %v", err)
+	}
+
+	// 非CA证书不能签发或作为CA加载
+	if _, err := cert.IssueClient(Options{}); !errors.Is(err, ErrNotCA) {
+		t.Fatalf("issue from leaf: %v", err)
+	}
+	leafCert, leafKey := filepath.Join(dir, "leaf.crt"), filepath.Join(dir, "leaf.key")
+	if err := cert.WriteFiles(leafCert, leafKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCA(leafCert, leafKey); !errors.Is(err, ErrNotCA) {
+		t.Fatalf("load leaf as CA: %v", err)
+	}
+	if err := os.WriteFile(leafKey, []byte("not pem"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCA(certFile, leafKey); !errors.Is(err, ErrNoPEM) {
+		t.Fatalf("load without PEM: %v", err)
+	}
+}
+
+func TestGenerateKeyInvalidType(t *testing.T) {
+	if _, err := GenerateKey("dsa", 0); !errors.Is(err, ErrKeyTypeInvalid) {
+		t.Fatalf("GenerateKey(dsa): %v", err)
+	}
+}
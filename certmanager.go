@@ -0,0 +1,249 @@
+package snet
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// certState 一次加载得到的证书、CA池及文件修改时间
+type certState struct {
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime [3]time.Time // CA、证书、私钥文件的修改时间
+}
+
+// CertManager 证书管理器, 轮询证书文件的修改时间并在变化时重新加载.
+// 新的证书和CA池只影响之后的握手, 已建立的连接不受影响
+type CertManager struct {
+	caFile   string
+	certFile string
+	keyFile  string
+	interval time.Duration
+	state    atomic.Pointer[certState]
+	failed   [3]time.Time // 上次加载失败时的文件修改时间, 避免重复报告同一失败
+
+	mu       sync.Mutex
+	onReload func()
+	onError  func(error)
+	stop     chan struct{}
+}
+
+// NewCertManager 创建证书管理器并立即加载一次, interval为轮询间隔, 默认30秒
+func NewCertManager(caFile, certFile, keyFile string, interval time.Duration) (*CertManager, error) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	m := &CertManager{
+		caFile:   caFile,
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+	}
+	modTime, err := m.modTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.load(modTime); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// OnReload 设置重新加载成功的回调
+func (m *CertManager) OnReload(fn func()) *CertManager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onReload = fn
+	return m
+}
+
+// OnError 设置重新加载失败的回调, 失败时继续使用之前的证书
+func (m *CertManager) OnError(fn func(error)) *CertManager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onError = fn
+	return m
+}
+
+// Watch 开始轮询证书文件
+func (m *CertManager) Watch() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		return
+	}
+	m.stop = make(chan struct{})
+	go m.poll(m.stop)
+}
+
+// Stop 停止轮询
+func (m *CertManager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// poll 定期检查文件修改时间
+func (m *CertManager) poll(stop chan struct{}) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.check()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// check 文件有变化时重新加载
+func (m *CertManager) check() {
+	modTime, err := m.modTime()
+	if err == nil {
+		if modTime == m.state.Load().modTime || modTime == m.failed {
+			return
+		}
+		err = m.load(modTime)
+	}
+
+	m.mu.Lock()
+	onReload, onError := m.onReload, m.onError
+	m.mu.Unlock()
+	if err != nil {
+		m.failed = modTime
+		if onError != nil {
+			onError(err)
+		}
+		return
+	}
+	if onReload != nil {
+		onReload()
+	}
+}
+
+// Reload 立即重新加载, 失败时继续使用之前的证书
+func (m *CertManager) Reload() error {
+	modTime, err := m.modTime()
+	if err != nil {
+		return err
+	}
+	return m.load(modTime)
+}
+
+// modTime 读取三个文件的修改时间
+func (m *CertManager) modTime() ([3]time.Time, error) {
+	var modTime [3]time.Time
+	for i, file := range []string{m.caFile, m.certFile, m.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return modTime, fmt.Errorf("snet: %s: %w", file, ErrCertFileNotFound)
+			}
+			return modTime, fmt.Errorf("snet: %w", err)
+		}
+		modTime[i] = info.ModTime()
+	}
+	return modTime, nil
+}
+
+// load 加载证书和CA池, 成功后原子替换
+func (m *CertManager) load(modTime [3]time.Time) error {
+	cert, pool, err := load(m.caFile, m.certFile, m.keyFile)
+	if err != nil {
+		return err
+	}
+	m.state.Store(&certState{cert: &cert, pool: pool, modTime: modTime})
+	return nil
+}
+
+// Certificate 当前证书
+func (m *CertManager) Certificate() *tls.Certificate {
+	return m.state.Load().cert
+}
+
+// CertPool 当前CA池
+func (m *CertManager) CertPool() *x509.CertPool {
+	return m.state.Load().pool
+}
+
+// ServerConfig 服务端TLS配置, 每次握手使用当前的证书和CA池校验客户端证书
+func (m *CertManager) ServerConfig(opts ...TLSOption) *tls.Config {
+	return applyTLSOptions(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			state := m.state.Load()
+			return serverConfig(*state.cert, state.pool, opts), nil
+		},
+	}, opts)
+}
+
+// ClientConfig 客户端TLS配置, 每次握手使用当前的证书并以当前的CA池校验服务端证书.
+// 服务端证书按WithServerName设置的名称校验, 未设置时按SNI中的主机名校验;
+// 以IP地址拨号时SNI为空, 需设置WithServerName, 否则握手失败
+func (m *CertManager) ClientConfig(opts ...TLSOption) *tls.Config {
+	return m.clientConfig("", opts)
+}
+
+// clientConfig host为拨号地址中的主机, 未设置ServerName时按它校验服务端证书
+func (m *CertManager) clientConfig(host string, opts []TLSOption) *tls.Config {
+	cfg := applyTLSOptions(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return m.Certificate(), nil
+		},
+		// RootCAs无法按握手替换, 关闭内置校验后在VerifyConnection中以当前CA池完成同样的校验
+		InsecureSkipVerify: true,
+	}, opts)
+
+	name := cfg.ServerName
+	if name == "" {
+		name = host
+	}
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return ErrCertInvalid
+		}
+		serverName := name
+		if serverName == "" {
+			serverName = cs.ServerName
+		}
+		// 没有可校验的名称时拒绝连接, 否则任何由CA签发的证书都能冒充服务端
+		if serverName == "" {
+			return fmt.Errorf("snet: no server name to verify the certificate against: %w", ErrCertInvalid)
+		}
+		verify := x509.VerifyOptions{
+			DNSName:       serverName,
+			Roots:         m.CertPool(),
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			verify.Intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(verify)
+		return err
+	}
+	return cfg
+}
+
+// SetServerCertManager 以证书管理器设置服务器端认证配置, 证书文件变化后新连接使用新证书
+func SetServerCertManager(m *CertManager, opts ...TLSOption) {
+	serverAuthConfig = m.ServerConfig(opts...)
+}
+
+// SetClientCertManager 以证书管理器设置客户端认证配置, 默认按拨号地址中的主机校验服务端证书
+func SetClientCertManager(m *CertManager, opts ...TLSOption) {
+	clientAuthConfig = m.ClientConfig(opts...)
+	clientAuthForHost = func(host string) *tls.Config {
+		return m.clientConfig(host, opts)
+	}
+}
@@ -0,0 +1,198 @@
+package snet
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/laazua/snet/certgen"
+)
+
+// certManagers 在临时目录生成CA和服务端、客户端证书, 返回对应的证书管理器.
+// 服务端证书的SAN为serverHosts
+func certManagers(t *testing.T, serverHosts ...string) (server, client *CertManager) {
+	t.Helper()
+	dir := t.TempDir()
+	ca, err := certgen.NewCA(certgen.Options{CommonName: "test ca"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caFile, ca.CertPEM(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	managers := make([]*CertManager, 2)
+	for i, name := range []string{"server", "client"} {
+		var cert *certgen.Certificate
+		if name == "server" {
+			cert, err = ca.IssueServer(certgen.Options{CommonName: name, Hosts: serverHosts})
+		} else {
+			cert, err = ca.IssueClient(certgen.Options{CommonName: name})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+		if err := cert.WriteFiles(certFile, keyFile); err != nil {
+			t.Fatal(err)
+		}
+		if managers[i], err = NewCertManager(caFile, certFile, keyFile, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return managers[0], managers[1]
+}
+
+// useCertManagers 以证书管理器启用TLS, 测试结束时恢复为明文连接
+func useCertManagers(t *testing.T, server, client *CertManager) {
+	SetServerCertManager(server)
+	SetClientCertManager(client)
+	t.Cleanup(func() {
+		SetServerTLSConfig(nil)
+		SetClientTLSConfig(nil)
+	})
+}
+
+// tlsServer 启动TLS服务器, Chat包返回客户端证书的CN
+func tlsServer(t *testing.T) string {
+	s := NewServer("")
+	s.AddHandlerFunc(PacketTypeChat, func(conn *Conn, packet *Packet) {
+		conn.SendPacket(NewPacket(PacketTypeChat, []byte(conn.PeerIdentity().CommonName), packet.Header.Seq))
+	})
+	return startServer(t, s)
+}
+
+func TestCertManagerVerifiesDialHost(t *testing.T) {
+	server, client := certManagers(t, "127.0.0.1")
+	useCertManagers(t, server, client)
+
+	c := dialClient(t, tlsServer(t))
+	if cn := c.PeerIdentity().CommonName; cn != "server" {
+		t.Fatalf("server CN %q", cn)
+	}
+}
+
+func TestCertManagerRejectsWrongHost(t *testing.T) {
+	server, client := certManagers(t, "other.example")
+	useCertManagers(t, server, client)
+
+	c := NewClient(tlsServer(t))
+	if err := c.Connect(); err == nil {
+		c.Close()
+		t.Fatal("connected to a server whose certificate does not name the dialed IP")
+	}
+}
+
+func TestCertManagerClientConfigServerName(t *testing.T) {
+	server, client := certManagers(t, "127.0.0.1")
+	SetServerCertManager(server)
+	t.Cleanup(func() { SetServerTLSConfig(nil) })
+	addr := tlsServer(t)
+
+	// 以IP拨号且未设置名称时无法校验服务端证书
+	if conn, err := tls.Dial("tcp", addr, client.ClientConfig()); err == nil {
+		conn.Close()
+		t.Fatal("handshake succeeded without a server name to verify")
+	} else if !errors.Is(err, ErrCertInvalid) {
+		t.Fatalf("handshake error %v, want ErrCertInvalid", err)
+	}
+
+	conn, err := tls.Dial("tcp", addr, client.ClientConfig(WithServerName("127.0.0.1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+// rotate 以新的CA重新签发服务端和客户端证书并覆盖原文件, 修改时间设为at
+func rotate(t *testing.T, server, client *CertManager, serverCN string, at time.Time) {
+	t.Helper()
+	ca, err := certgen.NewCA(certgen.Options{CommonName: "rotated ca"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCert, err := ca.IssueServer(certgen.Options{CommonName: serverCN, Hosts: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := ca.IssueClient(certgen.Options{CommonName: "client"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(server.caFile, ca.CertPEM(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := serverCert.WriteFiles(server.certFile, server.keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := clientCert.WriteFiles(client.certFile, client.keyFile); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{server.caFile, server.certFile, server.keyFile, client.certFile, client.keyFile} {
+		if err := os.Chtimes(file, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCertManagerHotReload(t *testing.T) {
+	server, client := certManagers(t, "127.0.0.1")
+	useCertManagers(t, server, client)
+	reloaded := make(chan struct{}, 1)
+	failed := make(chan error, 1)
+	server.interval = 10 * time.Millisecond
+	server.OnReload(func() { reloaded <- struct{}{} }).OnError(func(err error) { failed <- err })
+	server.Watch()
+	defer server.Stop()
+	addr := tlsServer(t)
+
+	before := dialClient(t, addr)
+	if cn := before.PeerIdentity().CommonName; cn != "server" {
+		t.Fatalf("server CN %q", cn)
+	}
+
+	rotate(t, server, client, "server2", time.Now().Add(time.Second))
+	select {
+	case <-reloaded:
+	case err := <-failed:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server certificate not reloaded")
+	}
+	if err := client.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 新连接使用新证书, 已建立的连接不受影响
+	after := dialClient(t, addr)
+	if cn := after.PeerIdentity().CommonName; cn != "server2" {
+		t.Fatalf("server CN after reload %q", cn)
+	}
+	if _, err := before.Request(context.Background(), PacketTypeChat, nil); err != nil {
+		t.Fatalf("existing connection after reload: %v", err)
+	}
+
+	// 加载失败时继续使用之前的证书, 同一失败只报告一次
+	current := server.Certificate()
+	if err := os.WriteFile(server.certFile, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload failure not reported")
+	}
+	select {
+	case err := <-failed:
+		t.Fatalf("failure reported twice: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if server.Certificate() != current {
+		t.Fatal("certificate replaced by a failed reload")
+	}
+}
@@ -0,0 +1,44 @@
+package snet
+
+import "context"
+
+// OpenChannel 在连接上打开一条逻辑通道, 各通道的数据按帧交错发送并独立流控
+func (c *Conn) OpenChannel(ctx context.Context) (*Stream, error) {
+	return c.streams.open(ctx, PacketTypeChannel)
+}
+
+// AcceptChannel 等待对端打开的逻辑通道
+func (c *Conn) AcceptChannel(ctx context.Context) (*Stream, error) {
+	for {
+		select {
+		case stream := <-c.streams.backlog:
+			// 排队期间可能已被对端取消
+			if stream.failure() != nil {
+				continue
+			}
+			return stream, nil
+		case <-c.closed:
+			return nil, ErrConnClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// OpenChannel 在客户端连接上打开一条逻辑通道
+func (c *Client) OpenChannel(ctx context.Context) (*Stream, error) {
+	conn, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	return conn.OpenChannel(ctx)
+}
+
+// AcceptChannel 等待服务端打开的逻辑通道
+func (c *Client) AcceptChannel(ctx context.Context) (*Stream, error) {
+	conn, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	return conn.AcceptChannel(ctx)
+}
@@ -0,0 +1,129 @@
+package snet
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// channelServer 接受客户端打开的通道并原样返回, 连接建立后由server通道发送给测试
+func channelServer(t *testing.T) (string, chan *Conn) {
+	t.Helper()
+	conns := make(chan *Conn, 1)
+	s := NewServer("")
+	s.AddHandlerFunc(PacketTypeChat, func(conn *Conn, packet *Packet) {})
+	s.OnConnect(func(conn *Conn) {
+		conns <- conn
+		go func() {
+			for {
+				ch, err := conn.AcceptChannel(context.Background())
+				if err != nil {
+					return
+				}
+				go echoStream(ch)
+			}
+		}()
+	})
+	return startServer(t, s), conns
+}
+
+func TestChannelsAreIndependent(t *testing.T) {
+	addr, _ := channelServer(t)
+	c := dialClient(t, addr)
+	ctx := context.Background()
+
+	slow, err := c.OpenChannel(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, err := c.OpenChannel(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slow.ID() == fast.ID() {
+		t.Fatal("channels share an id")
+	}
+
+	// slow的回显不读取, 其接收窗口耗尽后不影响fast
+	big := bytes.Repeat([]byte("s"), 2*streamWindowSize)
+	go slow.Send(big)
+	time.Sleep(50 * time.Millisecond)
+
+	for i := range 10 {
+		msg := []byte{byte(i)}
+		if err := fast.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+		packet, err := fast.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(packet.Data, msg) || packet.Header.Type != PacketTypeChannel {
+			t.Fatalf("fast channel got type %d data %v", packet.Header.Type, packet.Data)
+		}
+	}
+
+	packet, err := slow.Recv()
+	if err != nil || !bytes.Equal(packet.Data, big) {
+		t.Fatalf("slow channel: %v", err)
+	}
+}
+
+func TestChannelOpenedByServer(t *testing.T) {
+	addr, conns := channelServer(t)
+	c := dialClient(t, addr)
+	conn := <-conns
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	accepted := make(chan *Stream, 1)
+	go func() {
+		ch, err := c.AcceptChannel(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- ch
+	}()
+
+	ch, err := conn.OpenChannel(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.Send([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	remote := <-accepted
+	if remote == nil {
+		t.FailNow()
+	}
+	packet, err := remote.Recv()
+	if err != nil || string(packet.Data) != "hello" {
+		t.Fatalf("client got %v %v", packet, err)
+	}
+	if remote.ID() != ch.ID() {
+		t.Fatalf("ids differ: %d and %d", remote.ID(), ch.ID())
+	}
+}
+
+func TestAcceptChannelClosedConn(t *testing.T) {
+	addr, conns := channelServer(t)
+	c := dialClient(t, addr)
+	<-conns
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.AcceptChannel(context.Background())
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	c.Close()
+	select {
+	case err := <-done:
+		if err != ErrConnClosed {
+			t.Fatalf("AcceptChannel after close: %v, want ErrConnClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("AcceptChannel not woken by close")
+	}
+}
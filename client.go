@@ -1,8 +1,12 @@
 package snet
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"log/slog"
 	"net"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -10,33 +14,66 @@ import (
 
 // Client TCP客户端
 type Client struct {
-	conn      *Conn
-	addr      string
-	seq       uint32
-	mu        sync.Mutex
-	connected bool
+	conn       *Conn
+	addr       string
+	seq        uint32
+	mu         sync.Mutex
+	connected  bool
+	priorities *priorityTable    // 出站包类型优先级
+	asyncWrite *AsyncWriteConfig // 异步发送配置, nil表示同步发送
+
+	pending   map[uint32]chan *Packet // 等待响应的请求(按序列号)
+	pendingMu sync.Mutex
+	inbox     chan *Packet   // 未被请求认领的数据包, 由Receive读取
+	inboxFull OverflowPolicy // inbox已满时的处理方式
+	done      chan struct{}  // 读循环退出时关闭
+	readErr   error          // 读循环退出原因
+	dropped   atomic.Uint64  // inbox或推送队列已满而丢弃的数据包数
+
+	handlers       map[PacketType]Handler // 服务端主动推送的数据包处理器
+	defaultHandler Handler
+	handlersMu     sync.RWMutex
+
+	hooks  lifecycleHooks // 连接生命周期回调
+	logger *slog.Logger   // 日志记录器, 默认不输出
 }
 
 // NewClient 创建客户端
 func NewClient(addr string) *Client {
 	return &Client{
-		addr: addr,
-		seq:  0,
+		addr:       addr,
+		seq:        0,
+		pending:    make(map[uint32]chan *Packet),
+		priorities: newPriorityTable(),
+		handlers:   make(map[PacketType]Handler),
+		logger:     discardLogger,
 	}
 }
 
 // Connect 连接服务器
 func (c *Client) Connect() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	if c.connected {
+		c.mu.Unlock()
 		return ErrClientConnected
 	}
+	err := c.dial()
+	conn := c.conn
+	c.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	c.hooks.connected(conn)
+	return nil
+}
+
+// dial 建立连接并启动读循环, 调用方需持有c.mu
+func (c *Client) dial() error {
 	var err error
 	var conn net.Conn
-	if clientAuthConfig != nil {
-		conn, err = tls.Dial("tcp", c.addr, clientAuthConfig)
+	if cfg := clientTLSConfig(c.addr); cfg != nil {
+		conn, err = tls.Dial("tcp", c.addr, cfg)
 	} else {
 		conn, err = net.Dial("tcp", c.addr)
 	}
@@ -45,32 +82,291 @@ func (c *Client) Connect() error {
 	}
 
 	c.conn = newConn(conn)
+	c.conn.setLogger(c.logger)
+	if err := c.conn.handshake(); err != nil {
+		conn.Close()
+		return err
+	}
+	c.conn.streams.setClient()
+	c.conn.priorities = c.priorities
+	if c.asyncWrite != nil {
+		c.conn.startAsyncWriter(*c.asyncWrite)
+	}
 	c.connected = true
+	c.inbox = make(chan *Packet, 64)
+	c.done = make(chan struct{})
+	c.readErr = nil
+	pushes := make(chan *Packet, 256)
+	go c.readLoop(c.conn, c.inbox, c.inboxFull, pushes, c.done)
+	go c.dispatchLoop(c.conn, pushes)
 
 	return nil
 }
 
-// Send 发送数据
-func (c *Client) Send(dataType PacketType, data []byte) error {
+// readLoop 持续读取数据包: 有等待者的响应交给对应请求,
+// 注册了handler的包类型交给dispatchLoop, 其余放入inbox.
+// 推送队列已满时丢弃推送, 避免慢handler阻塞请求的响应; inbox已满时按inboxFull等待Receive或丢弃
+func (c *Client) readLoop(conn *Conn, inbox chan *Packet, inboxFull OverflowPolicy, pushes chan *Packet, done chan struct{}) {
+	defer c.hooks.closed(conn)
+	defer close(done)
+	defer close(pushes)
+
+	for {
+		packet, err := conn.readPacket()
+		if err != nil {
+			conn.setCloseReason(closeReasonOf(err))
+			if isProtocolError(err) {
+				conn.logger.Warn("invalid packet", slog.Any("error", err))
+				c.hooks.packetError(conn, nil, err)
+			}
+			conn.logger.Debug("connection closed", slog.String("reason", conn.CloseReason().String()))
+			conn.streams.closeAll(err)
+			c.mu.Lock()
+			if c.conn == conn {
+				c.readErr = err
+			}
+			c.mu.Unlock()
+			return
+		}
+
+		if packet.Header.Stream != 0 {
+			conn.streams.dispatch(packet)
+			continue
+		}
+		// 服务端告知关闭原因, 随后由服务端关闭连接
+		if packet.Header.Type == PacketTypeDisconnect {
+			conn.setCloseReason(disconnectReason(packet))
+			continue
+		}
+		if c.deliver(packet) {
+			continue
+		}
+
+		target := inbox
+		if c.getHandler(packet.Header.Type) != nil {
+			target = pushes
+		} else if inboxFull == OverflowBlock {
+			// 等待Receive取走, 与未缓冲时一样由TCP向服务端施加背压
+			select {
+			case inbox <- packet:
+			case <-conn.closed:
+			}
+			continue
+		}
+		select {
+		case target <- packet:
+		default:
+			c.dropped.Add(1)
+			conn.logger.Warn("client queue full, packet dropped", packetAttrs(packet)...)
+		}
+	}
+}
+
+// Dropped 因推送队列或inbox已满而丢弃的数据包数, handler过慢或以OverflowReject设置inbox后未及时调用Receive时增长
+func (c *Client) Dropped() uint64 {
+	return c.dropped.Load()
+}
+
+// dispatchLoop 按到达顺序调用推送数据包的handler, 推送队列已满时新的推送被丢弃, 慢handler不会阻塞请求的响应
+func (c *Client) dispatchLoop(conn *Conn, pushes chan *Packet) {
+	for packet := range pushes {
+		if handler := c.getHandler(packet.Header.Type); handler != nil {
+			handler.Handle(conn, packet)
+		}
+	}
+}
+
+// getHandler 获取推送数据包的handler
+func (c *Client) getHandler(packetType PacketType) Handler {
+	c.handlersMu.RLock()
+	defer c.handlersMu.RUnlock()
+
+	if handler, exists := c.handlers[packetType]; exists {
+		return handler
+	}
+	return c.defaultHandler
+}
+
+// SetInboxOverflow 设置inbox已满时的处理方式, 需在Connect前调用.
+// 默认OverflowBlock: 读循环等待Receive取走数据包, 数据包不会丢失, 但此后到达的响应也要等待;
+// OverflowReject: 丢弃新的数据包并计入Dropped
+func (c *Client) SetInboxOverflow(policy OverflowPolicy) *Client {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.inboxFull = policy
+	return c
+}
+
+// SetHandler 设置默认handler, 未被请求认领且没有对应类型handler的数据包都交给它,
+// 设置后Receive将不再收到数据包
+func (c *Client) SetHandler(handler Handler) *Client {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+	c.defaultHandler = handler
+	return c
+}
 
+// AddHandler 添加服务端主动推送数据包的handler, 按包类型分发,
+// 与Request等待中的序列号相同的响应仍交给调用方
+func (c *Client) AddHandler(packetType PacketType, handler Handler) *Client {
+	c.handlersMu.Lock()
+	defer c.handlersMu.Unlock()
+	c.handlers[packetType] = handler
+	return c
+}
+
+// AddHandlerFunc 添加服务端主动推送数据包的handler函数
+func (c *Client) AddHandlerFunc(packetType PacketType, handlerFunc func(conn *Conn, packet *Packet)) *Client {
+	return c.AddHandler(packetType, HandlerFunc(handlerFunc))
+}
+
+// deliver 将响应投递给等待中的请求
+func (c *Client) deliver(packet *Packet) bool {
+	c.pendingMu.Lock()
+	ch, ok := c.pending[packet.Header.Seq]
+	if ok {
+		delete(c.pending, packet.Header.Seq)
+	}
+	c.pendingMu.Unlock()
+
+	if ok {
+		ch <- packet
+	}
+	return ok
+}
+
+// send 发送数据包并返回使用的序列号, 调用方需持有c.mu
+func (c *Client) send(dataType PacketType, data []byte, wait chan *Packet) (uint32, error) {
 	if !c.connected {
-		return ErrClientNotConnected
+		return 0, ErrClientNotConnected
 	}
 
 	seq := atomic.AddUint32(&c.seq, 1)
+	if wait != nil {
+		c.pendingMu.Lock()
+		c.pending[seq] = wait
+		c.pendingMu.Unlock()
+	}
+
 	packet := NewPacket(dataType, data, seq)
-	return c.conn.SendPacket(packet)
+	if err := c.conn.SendPacket(packet); err != nil {
+		if wait != nil {
+			c.forget(seq)
+		}
+		return 0, err
+	}
+	return seq, nil
 }
 
-// Receive 接收数据
+// forget 取消对某个序列号响应的等待
+func (c *Client) forget(seq uint32) {
+	c.pendingMu.Lock()
+	delete(c.pending, seq)
+	c.pendingMu.Unlock()
+}
+
+// Send 发送数据
+func (c *Client) Send(dataType PacketType, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.send(dataType, data, nil)
+	return err
+}
+
+// Request 发送数据并等待序列号相同的响应
+func (c *Client) Request(ctx context.Context, dataType PacketType, data []byte) (*Packet, error) {
+	wait := make(chan *Packet, 1)
+
+	c.mu.Lock()
+	seq, err := c.send(dataType, data, wait)
+	done := c.done
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case packet := <-wait:
+		return packet, nil
+	case <-ctx.Done():
+		c.forget(seq)
+		return nil, ctx.Err()
+	case <-done:
+		c.forget(seq)
+		// 读循环退出前可能已投递响应
+		select {
+		case packet := <-wait:
+			return packet, nil
+		default:
+		}
+		return nil, c.receiveErr()
+	}
+}
+
+// requestAck 发送请求, 服务端以PacketTypeError回复时返回其中的错误信息
+func (c *Client) requestAck(ctx context.Context, packetType PacketType, data []byte) error {
+	packet, err := c.Request(ctx, packetType, data)
+	if err != nil {
+		return err
+	}
+	if packet.Header.Type == PacketTypeError {
+		return errors.New(string(packet.Data))
+	}
+	return nil
+}
+
+// Receive 接收未被请求认领的数据, 最多缓冲64个, 超出时的处理方式见SetInboxOverflow
 func (c *Client) Receive() (*Packet, error) {
+	c.mu.Lock()
 	if !c.connected {
+		c.mu.Unlock()
 		return nil, ErrClientNotConnected
 	}
+	inbox, done, timeout := c.inbox, c.done, c.conn.readTimeout
+	c.mu.Unlock()
 
-	return c.conn.ReceivePacket()
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case packet := <-inbox:
+		return packet, nil
+	case <-done:
+		// 读循环已退出, 先取完缓冲中的数据包
+		select {
+		case packet := <-inbox:
+			return packet, nil
+		default:
+		}
+		return nil, c.receiveErr()
+	case <-expired:
+		return nil, os.ErrDeadlineExceeded
+	}
+}
+
+// current 当前连接
+func (c *Client) current() (*Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return nil, ErrClientNotConnected
+	}
+	return c.conn, nil
+}
+
+// receiveErr 读循环退出原因
+func (c *Client) receiveErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.readErr != nil {
+		return c.readErr
+	}
+	return ErrClientNotConnected
 }
 
 // IsConnected 检查连接状态
@@ -83,42 +379,40 @@ func (c *Client) IsConnected() bool {
 // Reconnect 重新连接
 func (c *Client) Reconnect() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	if c.connected {
-		c.conn.Close()
+		c.conn.Disconnect(CloseNormal)
 		c.connected = false
 	}
+	err := c.dial()
+	conn := c.conn
+	c.mu.Unlock()
 
-	var err error
-	var conn net.Conn
-	if clientAuthConfig != nil {
-		conn, err = tls.Dial("tcp", c.addr, clientAuthConfig)
-	} else {
-		conn, err = net.Dial("tcp", c.addr)
-	}
 	if err != nil {
 		return err
 	}
-
-	c.conn = newConn(conn)
-	c.connected = true
+	c.hooks.connected(conn)
 	return nil
 }
 
-// Close 关闭连接
+// Close 通知服务端后关闭连接
 func (c *Client) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if c.connected {
 		c.connected = false
-		return c.conn.Close()
+		return c.conn.Disconnect(CloseNormal)
 	}
 
 	return nil
 }
 
+// SetPacketPriority 设置包类型的出站优先级
+func (c *Client) SetPacketPriority(packetType PacketType, priority Priority) *Client {
+	c.priorities.set(packetType, priority)
+	return c
+}
+
 // SetTimeout 设置超时
 func (c *Client) SetTimeout(readTimeout, writeTimeout time.Duration) {
 	if c.conn != nil {
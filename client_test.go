@@ -0,0 +1,152 @@
+package snet
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// pushServer 收到Command后先推送n个Notification, 再以Ack回复, n为数据部分的第一个字节
+func pushServer(t *testing.T) string {
+	t.Helper()
+	s := NewServer("")
+	s.AddHandlerFunc(PacketTypeCommand, func(conn *Conn, packet *Packet) {
+		for i := range int(packet.Data[0]) {
+			conn.SendPacket(NewPacket(PacketTypeNotification, []byte{byte(i)}, 0))
+		}
+		conn.SendPacket(NewPacket(PacketTypeAck, nil, packet.Header.Seq))
+	})
+	return startServer(t, s)
+}
+
+func TestClientPushHandler(t *testing.T) {
+	c := NewClient(pushServer(t))
+	pushes := make(chan byte, 8)
+	c.AddHandlerFunc(PacketTypeNotification, func(conn *Conn, packet *Packet) {
+		pushes <- packet.Data[0]
+	})
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	packet, err := c.Request(context.Background(), PacketTypeCommand, []byte{3})
+	if err != nil || packet.Header.Type != PacketTypeAck {
+		t.Fatalf("Request: %v %v", packet, err)
+	}
+	// 推送按到达顺序交给handler
+	for i := range 3 {
+		select {
+		case b := <-pushes:
+			if b != byte(i) {
+				t.Fatalf("push %d out of order: %d", i, b)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("push %d not handled", i)
+		}
+	}
+}
+
+func TestClientSlowPushHandlerDoesNotBlockRequests(t *testing.T) {
+	c := NewClient(pushServer(t))
+	release := make(chan struct{})
+	defer close(release)
+	c.AddHandlerFunc(PacketTypeNotification, func(conn *Conn, packet *Packet) {
+		<-release
+	})
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// 推送超过推送队列容量, 超出的被丢弃
+	for range 3 {
+		if _, err := c.Request(ctx, PacketTypeCommand, []byte{200}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Dropped() == 0 {
+		t.Fatal("no pushes dropped while the handler was blocked")
+	}
+}
+
+func TestClientInboxOverflow(t *testing.T) {
+	c := NewClient(pushServer(t)).SetInboxOverflow(OverflowReject)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// 没有handler的推送进入inbox, 设置OverflowReject后不调用Receive时超出容量的被丢弃, 不影响请求的响应
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.Request(ctx, PacketTypeCommand, []byte{100}); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Dropped(); n != 100-64 {
+		t.Fatalf("dropped %d, want %d", n, 100-64)
+	}
+	packet, err := c.Receive()
+	if err != nil || packet.Header.Type != PacketTypeNotification || packet.Data[0] != 0 {
+		t.Fatalf("Receive: %v %v", packet, err)
+	}
+}
+
+func TestClientDefaultHandler(t *testing.T) {
+	c := NewClient(pushServer(t))
+	pushes := make(chan *Packet, 1)
+	c.SetHandler(HandlerFunc(func(conn *Conn, packet *Packet) { pushes <- packet }))
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// 与等待中请求序列号相同的响应仍交给调用方
+	packet, err := c.Request(context.Background(), PacketTypeCommand, []byte{1})
+	if err != nil || packet.Header.Type != PacketTypeAck {
+		t.Fatalf("Request: %v %v", packet, err)
+	}
+	select {
+	case packet := <-pushes:
+		if packet.Header.Type != PacketTypeNotification {
+			t.Fatalf("default handler got type %d", packet.Header.Type)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("default handler not called")
+	}
+}
+
+func TestClientReceiveLossless(t *testing.T) {
+	s := NewServer("")
+	s.AddHandlerFunc(PacketTypeChat, func(conn *Conn, packet *Packet) {
+		conn.SendPacket(NewPacket(PacketTypeChat, packet.Data, packet.Header.Seq))
+	})
+	c := dialClient(t, startServer(t, s))
+
+	// 默认不丢弃未读取的数据包, 超出inbox容量时由TCP背压
+	const n = 200
+	for i := range n {
+		if err := c.Send(PacketTypeChat, []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 服务端并发处理, 响应的顺序不确定
+	var seen [n]bool
+	for i := range n {
+		packet, err := c.Receive()
+		if err != nil {
+			t.Fatalf("Receive %d: %v", i, err)
+		}
+		seen[packet.Data[0]] = true
+	}
+	for i, ok := range seen {
+		if !ok {
+			t.Fatalf("packet %d not received", i)
+		}
+	}
+	if n := c.Dropped(); n != 0 {
+		t.Fatalf("dropped %d packets", n)
+	}
+}
@@ -1,8 +1,10 @@
 package snet
 
 import (
+	"bytes"
 	"encoding/binary"
 	"io"
+	"slices"
 )
 
 // Encoder 编码器接口
@@ -33,14 +35,34 @@ func (e *defaultEncoder) encode(packet *Packet) ([]byte, error) {
 		return nil, err
 	}
 
-	return buf.Bytes(), nil
+	// 缓冲区会归还到池中, 返回副本
+	return bytes.Clone(buf.Bytes()), nil
 }
 
 // DefaultDecoder 默认解码器
 type defaultDecoder struct{}
 
 func (d *defaultDecoder) decode(reader io.Reader) (*Packet, error) {
-	// 读取协议头
+	header, err := readHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// 验证数据长度
+	if header.Length > MaxPacketSize {
+		return nil, ErrPacketTooLarge
+	}
+
+	data, err := readBody(reader, header.Length)
+	if err != nil {
+		return nil, err
+	}
+	return checkPacket(header, data)
+}
+
+// readHeader 读取并校验协议头的魔数和版本.
+// 版本字段在各版本协议头中的位置相同, 对端使用其他版本时在读取数据前返回ErrProtocolVersion
+func readHeader(reader io.Reader) (*packetHeader, error) {
 	header := &packetHeader{}
 	if err := binary.Read(reader, binary.BigEndian, header); err != nil {
 		return nil, err
@@ -50,33 +72,46 @@ func (d *defaultDecoder) decode(reader io.Reader) (*Packet, error) {
 	if header.Magic != MagicNumber {
 		return nil, ErrMagicNumberInvalid
 	}
-
-	// 验证数据长度
-	if header.Length > MaxPacketSize {
-		return nil, ErrPacketTooLarge
+	if header.Version != ProtocolVersion {
+		return nil, ErrProtocolVersion
 	}
+	return header, nil
+}
 
-	// 使用字节切片池读取数据
-	dataBuf := GetByteSlice()
-	defer PutByteSlice(dataBuf)
-
-	// 确保有足够容量
-	if cap(dataBuf) < int(header.Length) {
-		// 容量不足，创建新的切片
-		dataBuf = make([]byte, header.Length)
-	} else {
-		// 重用切片，设置正确长度
-		dataBuf = dataBuf[:header.Length]
+// 超过该长度的数据按实际到达的字节逐步扩容读取
+const bodyChunkSize = 64 * 1024
+
+// readBody 读取length字节的数据.
+// 大包不按协议头声明的长度一次性分配, 避免对端只发送包头就占用大量内存
+func readBody(reader io.Reader, length uint32) ([]byte, error) {
+	n := int(length)
+	if n <= bodyChunkSize {
+		data := make([]byte, n)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return data, nil
 	}
 
-	if _, err := io.ReadFull(reader, dataBuf); err != nil {
-		return nil, err
+	data := make([]byte, 0, bodyChunkSize)
+	for len(data) < n {
+		if len(data) == cap(data) {
+			data = slices.Grow(data, min(cap(data), n-len(data)))
+		}
+		m, err := reader.Read(data[len(data):min(cap(data), n)])
+		data = data[:len(data)+m]
+		if err != nil && len(data) < n {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
 	}
+	return data, nil
+}
 
-	// 创建数据副本（重要！因为池中的切片会被复用）
-	data := make([]byte, header.Length)
-	copy(data, dataBuf)
-
+// checkPacket 组装并校验数据包
+func checkPacket(header *packetHeader, data []byte) (*Packet, error) {
 	packet := &Packet{
 		Header: header,
 		Data:   data,
@@ -1,30 +1,71 @@
 package snet
 
 import (
+	"log/slog"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// connID 连接ID生成器
+var connID atomic.Uint64
+
 // Conn 连接封装
 type Conn struct {
 	net.Conn
+	id           uint64   // 进程内唯一的连接ID
+	session      *Session // 连接会话
 	encoder      encoder
 	decoder      decoder
 	readTimeout  time.Duration
 	writeTimeout time.Duration
 	mu           sync.Mutex
+	wl           writeLock      // 写锁, 保证帧完整并按优先级写出
+	priorities   *priorityTable // 包类型优先级
+	closed       chan struct{}  // 连接关闭时关闭
+	closeOnce    sync.Once
+	streams      *streamTable   // 复用在连接上的流
+	aw           *asyncWriter   // 异步写协程, 未启用时为nil
+	peer         *PeerIdentity  // TLS对端身份, 握手完成后设置
+	closeReason  atomic.Uint32  // 关闭原因, 见CloseReason
+	logger       *slog.Logger   // 带连接字段的日志记录器
+	metrics      *serverMetrics // 服务器的运行指标, 客户端连接为nil
+	authTimer    *time.Timer    // 认证宽限期计时器, 未启用认证时为nil
 }
 
 // NewConn 创建连接
 func newConn(conn net.Conn) *Conn {
-	return &Conn{
+	c := &Conn{
 		Conn:         conn,
+		id:           connID.Add(1),
+		session:      newSession(),
 		encoder:      &defaultEncoder{},
 		decoder:      &defaultDecoder{},
 		readTimeout:  30 * time.Second,
 		writeTimeout: 30 * time.Second,
+		closed:       make(chan struct{}),
+		priorities:   defaultPriorities,
+		logger:       discardLogger,
 	}
+	c.streams = newStreamTable(c)
+	return c
+}
+
+// startAsyncWriter 启用异步批量发送, 需在连接开始收发前调用
+func (c *Conn) startAsyncWriter(cfg AsyncWriteConfig) {
+	c.aw = newAsyncWriter(c, cfg)
+	go c.aw.run()
+}
+
+// ID 连接ID, 进程内唯一且在连接生命周期内不变
+func (c *Conn) ID() uint64 {
+	return c.id
+}
+
+// Session 连接会话
+func (c *Conn) Session() *Session {
+	return c.session
 }
 
 // SetTimeout 设置超时时间
@@ -35,19 +76,29 @@ func (c *Conn) SetTimeout(readTimeout, writeTimeout time.Duration) {
 
 // SendPacket 发送数据包
 func (c *Conn) SendPacket(packet *Packet) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	data, err := c.encoder.encode(packet)
 	if err != nil {
 		return err
 	}
 
+	return c.write(c.priorities.of(packet), data)
+}
+
+// write 写出编码后的数据包
+func (c *Conn) write(priority Priority, data []byte) error {
+	// 异步发送时由写协程在写出后统计
+	if c.aw != nil {
+		return c.aw.enqueue(priority, data)
+	}
+	c.wl.lock(priority)
 	if c.writeTimeout > 0 {
 		c.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
 	}
-
-	_, err = c.Conn.Write(data)
+	_, err := c.Conn.Write(data)
+	c.wl.unlock()
+	if err == nil {
+		c.metrics.sent(data)
+	}
 	return err
 }
 
@@ -60,8 +111,32 @@ func (c *Conn) ReceivePacket() (*Packet, error) {
 	return c.decoder.decode(c.Conn)
 }
 
+// readPacket 读取数据包(不设置读超时, 供常驻读循环使用)
+func (c *Conn) readPacket() (*Packet, error) {
+	return c.decoder.decode(c.Conn)
+}
+
+// isClosed 连接是否已关闭
+func (c *Conn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
 // Close 关闭连接
 func (c *Conn) Close() error {
+	c.setCloseReason(CloseNormal)
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.streams.closeAll(ErrConnClosed)
+	})
+	// 等待写协程写出剩余数据
+	if c.aw != nil {
+		<-c.aw.done
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	return c.Conn.Close()
@@ -9,8 +9,29 @@ var (
 	ErrMagicNumberInvalid     = errors.New("invalid magic number")
 	ErrPacketTooLarge         = errors.New("packet too large")
 	ErrPacketIvalid           = errors.New("invalid packet")
+	ErrProtocolVersion        = errors.New("unsupported protocol version")
 	ErrWorkerPoolClosed       = errors.New("worker pool is closed")
 	ErrWorkerPoolQueueFull    = errors.New("worker pool queue is full")
 	ErrServerHandlerNotSet    = errors.New("server handler not set")
+	ErrHandlerNotFound        = errors.New("no handler for packet type")
 	ErrServerWorkerPoolNotSet = errors.New("server worker pool not set")
+	ErrRPCServiceInvalid      = errors.New("rpc: invalid service")
+	ErrRPCServiceRegistered   = errors.New("rpc: service already registered")
+	ErrRPCServiceNotFound     = errors.New("rpc: service not found")
+	ErrRPCMethodNotFound      = errors.New("rpc: method not found")
+	ErrRPCBadRequest          = errors.New("rpc: bad request")
+	ErrConnClosed             = errors.New("connection closed")
+	ErrStreamClosed           = errors.New("stream closed")
+	ErrStreamReset            = errors.New("stream reset by peer")
+	ErrStreamRefused          = errors.New("stream refused")
+	ErrStreamFlowControl      = errors.New("stream flow control violated")
+	ErrSendQueueFull          = errors.New("send queue is full")
+	ErrTopicInvalid           = errors.New("invalid topic")
+	ErrAuthFailed             = errors.New("authentication failed")
+	ErrAuthExpired            = errors.New("credentials expired")
+	ErrAuthRequired           = errors.New("authentication required")
+	ErrPermissionDenied       = errors.New("permission denied")
+	ErrCertInvalid            = errors.New("invalid certificate")
+	ErrRateLimited            = errors.New("rate limit exceeded")
+	ErrMemoryExhausted        = errors.New("memory budget exhausted")
 )
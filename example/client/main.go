@@ -27,6 +27,10 @@ func main() {
 	)
 
 	client := snet.NewClient("localhost:8082")
+	// 服务端主动推送的通知交给handler处理, 不会与请求的响应混在一起
+	client.AddHandlerFunc(snet.PacketTypeNotification, func(conn *snet.Conn, packet *snet.Packet) {
+		fmt.Println("Notification:", string(packet.Data))
+	})
 	if err := client.Connect(); err != nil {
 		log.Fatal(err)
 	}
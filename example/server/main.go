@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
@@ -14,11 +15,6 @@ import (
 )
 
 func main() {
-	// 启动 pprof 服务
-	// http://ip:8083/debug/pprof
-	go func() {
-		http.ListenAndServe(":8083", nil)
-	}()
 	// 设置服务器端TLS认证
 	snet.SetServerAuth(
 		"../certs/ssl/ca.crt",
@@ -27,6 +23,16 @@ func main() {
 	)
 
 	server := snet.NewServer(":8082").SetWorkerPool(100, 1000)
+	// 库默认不输出日志, 设置日志记录器后输出连接、数据包等结构化日志
+	server.SetLogger(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	// 启动 pprof 和 Prometheus 指标服务
+	// http://ip:8083/debug/pprof
+	// http://ip:8083/metrics
+	http.Handle("/metrics", server.MetricsHandler())
+	go func() {
+		http.ListenAndServe(":8083", nil)
+	}()
 
 	// 注册数据包处理函数(这里注册的数据包类型需要和客户端发送的数据包类型一致)
 	// server.AddHandlerFunc(snet.PacketTypeAuth, handleLogin)
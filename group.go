@@ -0,0 +1,247 @@
+package snet
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SlowPolicy 广播时接收方过慢的处理方式
+type SlowPolicy uint8
+
+const (
+	SlowSkip       SlowPolicy = iota // 该连接跳过本条消息
+	SlowDropOldest                   // 丢弃发送队列中最旧的数据包后入队, 仅对启用异步发送的连接有效, 否则同SlowSkip
+	SlowDisconnect                   // 断开该连接
+)
+
+// BroadcastConfig 广播配置
+type BroadcastConfig struct {
+	SlowTimeout time.Duration // 等待单个连接可写的最长时间, 默认500ms
+	Policy      SlowPolicy    // 超时后的处理方式
+	Concurrency int           // 并发写出的连接数, 默认64
+}
+
+// withDefaults 填充默认值
+func (cfg BroadcastConfig) withDefaults() BroadcastConfig {
+	if cfg.SlowTimeout <= 0 {
+		cfg.SlowTimeout = 500 * time.Millisecond
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 64
+	}
+	return cfg
+}
+
+// BroadcastResult 广播结果
+type BroadcastResult struct {
+	Sent         int // 成功写出或入队的连接数
+	Skipped      int // 因过慢跳过的连接数
+	Dropped      int // 因入队丢弃了旧数据包的连接数
+	Disconnected int // 被断开的连接数
+}
+
+// GroupManager 房间管理, 基于ConnManager向多个连接广播
+type GroupManager struct {
+	cm     *ConnManager
+	mu     sync.RWMutex
+	rooms  map[string]map[uint64]*Conn
+	joined map[uint64]map[string]struct{} // 连接ID -> 所在房间
+	cfg    BroadcastConfig
+}
+
+// NewGroupManager 创建房间管理器, 连接从ConnManager移除时自动离开所有房间
+func NewGroupManager(cm *ConnManager) *GroupManager {
+	g := &GroupManager{
+		cm:     cm,
+		rooms:  make(map[string]map[uint64]*Conn),
+		joined: make(map[uint64]map[string]struct{}),
+		cfg:    BroadcastConfig{}.withDefaults(),
+	}
+	cm.OnRemove(g.LeaveAll)
+	return g
+}
+
+// SetBroadcastConfig 设置广播配置
+func (g *GroupManager) SetBroadcastConfig(cfg BroadcastConfig) *GroupManager {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.cfg = cfg.withDefaults()
+	return g
+}
+
+// Join 加入房间, 连接已关闭时不加入
+func (g *GroupManager) Join(room string, conn *Conn) {
+	g.join(room, conn)
+
+	// 加入晚于ConnManager的移除回调时由这里撤销, 否则连接将一直留在房间中
+	if conn.isClosed() {
+		g.LeaveAll(conn)
+	}
+}
+
+// join 登记房间成员
+func (g *GroupManager) join(room string, conn *Conn) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.rooms[room] == nil {
+		g.rooms[room] = make(map[uint64]*Conn)
+	}
+	g.rooms[room][conn.id] = conn
+	if g.joined[conn.id] == nil {
+		g.joined[conn.id] = make(map[string]struct{})
+	}
+	g.joined[conn.id][room] = struct{}{}
+}
+
+// Leave 离开房间
+func (g *GroupManager) Leave(room string, conn *Conn) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.leave(room, conn.id)
+}
+
+// LeaveAll 离开所有房间
+func (g *GroupManager) LeaveAll(conn *Conn) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for room := range g.joined[conn.id] {
+		g.leave(room, conn.id)
+	}
+}
+
+// leave 调用方需持有g.mu
+func (g *GroupManager) leave(room string, id uint64) {
+	delete(g.rooms[room], id)
+	if len(g.rooms[room]) == 0 {
+		delete(g.rooms, room)
+	}
+	delete(g.joined[id], room)
+	if len(g.joined[id]) == 0 {
+		delete(g.joined, id)
+	}
+}
+
+// Members 房间内的连接
+func (g *GroupManager) Members(room string) []*Conn {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	conns := make([]*Conn, 0, len(g.rooms[room]))
+	for _, conn := range g.rooms[room] {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// Rooms 连接所在的房间
+func (g *GroupManager) Rooms(conn *Conn) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	rooms := make([]string, 0, len(g.joined[conn.id]))
+	for room := range g.joined[conn.id] {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// Broadcast 向房间内除exclude外的所有连接发送数据包, exclude可为nil
+func (g *GroupManager) Broadcast(room string, packet *Packet, exclude *Conn) (BroadcastResult, error) {
+	return g.fanout(g.Members(room), packet, exclude)
+}
+
+// BroadcastAll 向ConnManager中除exclude外的所有连接发送数据包
+func (g *GroupManager) BroadcastAll(packet *Packet, exclude *Conn) (BroadcastResult, error) {
+	return g.fanout(g.cm.snapshot(), packet, exclude)
+}
+
+// fanout 数据包只编码一次, 并发写出到各连接
+func (g *GroupManager) fanout(conns []*Conn, packet *Packet, exclude *Conn) (BroadcastResult, error) {
+	var result BroadcastResult
+	data, err := (&defaultEncoder{}).encode(packet)
+	if err != nil {
+		return result, err
+	}
+
+	g.mu.RLock()
+	cfg := g.cfg
+	g.mu.RUnlock()
+
+	var sent, skipped, dropped, disconnected atomic.Int64
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, cfg.Concurrency)
+	for _, conn := range conns {
+		if conn == exclude {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			wasDropped, err := conn.offer(conn.priorities.of(packet), data, cfg)
+			switch {
+			case err == nil:
+				sent.Add(1)
+				if wasDropped {
+					dropped.Add(1)
+				}
+			case errors.Is(err, ErrSendQueueFull) && cfg.Policy != SlowDisconnect:
+				skipped.Add(1)
+			default:
+				// 写出失败或策略要求断开, 关闭底层连接, 由读循环完成清理
+				if errors.Is(err, ErrSendQueueFull) {
+					conn.setCloseReason(CloseLimitExceeded)
+				} else {
+					conn.setCloseReason(CloseNetworkError)
+				}
+				conn.Conn.Close()
+				disconnected.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	result.Sent = int(sent.Load())
+	result.Skipped = int(skipped.Load())
+	result.Dropped = int(dropped.Load())
+	result.Disconnected = int(disconnected.Load())
+	return result, nil
+}
+
+// offer 在广播配置的时限内写出已编码的数据包, 超时返回ErrSendQueueFull
+func (c *Conn) offer(priority Priority, data []byte, cfg BroadcastConfig) (dropped bool, err error) {
+	// 异步发送时由写协程在写出后统计
+	if c.aw != nil {
+		return c.aw.offer(priority, data, cfg.SlowTimeout, cfg.Policy == SlowDropOldest)
+	}
+
+	if !c.wl.lockTimeout(priority, cfg.SlowTimeout) {
+		return false, ErrSendQueueFull
+	}
+	defer c.wl.unlock()
+
+	// 超时可能导致只写出部分数据, 此时连接已不可用
+	c.Conn.SetWriteDeadline(time.Now().Add(cfg.SlowTimeout))
+	_, err = c.Conn.Write(data)
+	if c.writeTimeout <= 0 {
+		c.Conn.SetWriteDeadline(time.Time{})
+	}
+	if err == nil {
+		c.metrics.sent(data)
+	}
+	return false, err
+}
+
+// Groups 服务器的房间管理器
+func (s *Server) Groups() *GroupManager {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.groups == nil {
+		s.groups = NewGroupManager(s.connManager)
+	}
+	return s.groups
+}
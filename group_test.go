@@ -0,0 +1,168 @@
+package snet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJoinAfterRemove(t *testing.T) {
+	cm := NewConnManager()
+	g := NewGroupManager(cm)
+	conn := pipeConn(t)
+	cm.Add(conn)
+
+	conn.Close()
+	cm.Remove(conn)
+	g.Join("lobby", conn)
+	if n := len(g.Members("lobby")); n != 0 {
+		t.Fatalf("%d members after joining with a closed conn", n)
+	}
+}
+
+func TestStopWhileHandlerUsesGroups(t *testing.T) {
+	entered := make(chan struct{})
+	proceed := make(chan struct{})
+	s := NewServer("")
+	s.AddHandlerFunc(PacketTypeChat, func(conn *Conn, packet *Packet) {
+		close(entered)
+		<-proceed
+		s.Groups().Join("lobby", conn)
+	})
+	c := dialClient(t, startServer(t, s))
+	if err := c.Send(PacketTypeChat, nil); err != nil {
+		t.Fatal(err)
+	}
+	<-entered
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(proceed)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop deadlocked waiting for a handler that calls Groups")
+	}
+}
+
+func TestGroupMembership(t *testing.T) {
+	cm := NewConnManager()
+	g := NewGroupManager(cm)
+	a, b := pipeConn(t), pipeConn(t)
+	cm.Add(a)
+	cm.Add(b)
+
+	g.Join("lobby", a)
+	g.Join("games", a)
+	g.Join("lobby", b)
+	if n := len(g.Members("lobby")); n != 2 {
+		t.Fatalf("lobby has %d members, want 2", n)
+	}
+	if rooms := g.Rooms(a); len(rooms) != 2 {
+		t.Fatalf("a is in %v", rooms)
+	}
+	g.Leave("lobby", b)
+	if n := len(g.Members("lobby")); n != 1 {
+		t.Fatalf("lobby has %d members after Leave, want 1", n)
+	}
+	// 从ConnManager移除时离开所有房间
+	cm.Remove(a)
+	if len(g.Members("lobby"))+len(g.Members("games"))+len(g.Rooms(a)) != 0 {
+		t.Fatal("removed connection still in rooms")
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	cm := NewConnManager()
+	g := NewGroupManager(cm)
+	var rcs []*recordConn
+	var conns []*Conn
+	for range 3 {
+		rc := &recordConn{}
+		conn := newConn(rc)
+		cm.Add(conn)
+		g.Join("lobby", conn)
+		rcs = append(rcs, rc)
+		conns = append(conns, conn)
+	}
+	cm.Add(newConn(&recordConn{}))
+
+	result, err := g.Broadcast("lobby", NewPacket(PacketTypeChat, []byte{1}, 0), conns[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (BroadcastResult{Sent: 2}) {
+		t.Fatalf("Broadcast = %+v", result)
+	}
+	for i, rc := range rcs {
+		want := 1
+		if i == 0 {
+			want = 0
+		}
+		if _, n := rc.written(); n != want {
+			t.Fatalf("member %d got %d packets, want %d", i, n, want)
+		}
+	}
+
+	result, err = g.BroadcastAll(NewPacket(PacketTypeChat, []byte{1}, 0), nil)
+	if err != nil || result.Sent != 4 {
+		t.Fatalf("BroadcastAll = %+v, %v", result, err)
+	}
+}
+
+func TestBroadcastSlowPolicies(t *testing.T) {
+	for _, policy := range []SlowPolicy{SlowSkip, SlowDisconnect} {
+		cm := NewConnManager()
+		g := NewGroupManager(cm).SetBroadcastConfig(BroadcastConfig{SlowTimeout: 10 * time.Millisecond, Policy: policy})
+		fast, slow := newConn(&recordConn{}), newConn(&recordConn{})
+		for _, conn := range []*Conn{fast, slow} {
+			cm.Add(conn)
+			g.Join("lobby", conn)
+		}
+		// 写锁被占用的连接视为过慢
+		slow.wl.lock(PriorityControl)
+
+		result, err := g.Broadcast("lobby", NewPacket(PacketTypeChat, []byte{1}, 0), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := BroadcastResult{Sent: 1, Skipped: 1}
+		if policy == SlowDisconnect {
+			want = BroadcastResult{Sent: 1, Disconnected: 1}
+		}
+		if result != want {
+			t.Fatalf("policy %d: %+v, want %+v", policy, result, want)
+		}
+		if policy == SlowDisconnect && slow.CloseReason() != CloseLimitExceeded {
+			t.Fatalf("slow connection closed with %v", slow.CloseReason())
+		}
+		slow.wl.unlock()
+	}
+}
+
+func TestBroadcastDropOldest(t *testing.T) {
+	cm := NewConnManager()
+	g := NewGroupManager(cm).SetBroadcastConfig(BroadcastConfig{SlowTimeout: 10 * time.Millisecond, Policy: SlowDropOldest})
+	rc := &recordConn{gate: make(chan struct{})}
+	conn := asyncConn(rc, AsyncWriteConfig{QueueSize: 1})
+	defer conn.Close()
+	defer close(rc.gate)
+	cm.Add(conn)
+	g.Join("lobby", conn)
+
+	// 第一个包阻塞在写出上, 第二个占满队列
+	g.Broadcast("lobby", NewPacket(PacketTypeChat, []byte{1}, 0), nil)
+	waitFor(t, "writer to block", func() bool { return rc.pending.Load() == 1 })
+	g.Broadcast("lobby", NewPacket(PacketTypeChat, []byte{2}, 0), nil)
+
+	result, err := g.Broadcast("lobby", NewPacket(PacketTypeChat, []byte{3}, 0), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (BroadcastResult{Sent: 1, Dropped: 1}) {
+		t.Fatalf("Broadcast = %+v", result)
+	}
+}
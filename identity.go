@@ -0,0 +1,113 @@
+package snet
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/url"
+)
+
+// PeerIdentity TLS对端身份, 来自握手时校验通过的证书
+type PeerIdentity struct {
+	Chain          []*x509.Certificate // 对端证书链, 校验通过时为校验链, 首个为对端证书
+	CommonName     string              // 证书主题CN
+	DNSNames       []string            // DNS类型SAN
+	EmailAddresses []string            // 邮箱类型SAN
+	IPAddresses    []net.IP            // IP类型SAN
+	URIs           []*url.URL          // URI类型SAN
+	SPIFFEID       string              // SPIFFE ID, 即scheme为spiffe的URI SAN, 没有时为空
+	TLSVersion     uint16              // 协商的TLS版本, 如tls.VersionTLS13
+	CipherSuite    uint16              // 协商的密码套件
+	Protocol       string              // ALPN协商的应用层协议, 未协商时为空
+}
+
+// newPeerIdentity 从TLS连接状态构建对端身份
+func newPeerIdentity(state tls.ConnectionState) *PeerIdentity {
+	id := &PeerIdentity{
+		TLSVersion:  state.Version,
+		CipherSuite: state.CipherSuite,
+		Protocol:    state.NegotiatedProtocol,
+	}
+	switch {
+	case len(state.VerifiedChains) > 0:
+		id.Chain = state.VerifiedChains[0]
+	case len(state.PeerCertificates) > 0:
+		id.Chain = state.PeerCertificates
+	default:
+		return id
+	}
+
+	cert := id.Chain[0]
+	id.CommonName = cert.Subject.CommonName
+	id.DNSNames = cert.DNSNames
+	id.EmailAddresses = cert.EmailAddresses
+	id.IPAddresses = cert.IPAddresses
+	id.URIs = cert.URIs
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			id.SPIFFEID = uri.String()
+			break
+		}
+	}
+	return id
+}
+
+// Certificate 对端证书, 对端未提供证书时为nil
+func (id *PeerIdentity) Certificate() *x509.Certificate {
+	if len(id.Chain) == 0 {
+		return nil
+	}
+	return id.Chain[0]
+}
+
+// SANs 所有类型的SAN的字符串形式
+func (id *PeerIdentity) SANs() []string {
+	sans := make([]string, 0, len(id.DNSNames)+len(id.EmailAddresses)+len(id.IPAddresses)+len(id.URIs))
+	sans = append(sans, id.DNSNames...)
+	sans = append(sans, id.EmailAddresses...)
+	for _, ip := range id.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range id.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+// TLSVersionName 协商的TLS版本名称, 如"TLS 1.3"
+func (id *PeerIdentity) TLSVersionName() string {
+	return tls.VersionName(id.TLSVersion)
+}
+
+// CipherSuiteName 协商的密码套件名称
+func (id *PeerIdentity) CipherSuiteName() string {
+	return tls.CipherSuiteName(id.CipherSuite)
+}
+
+// handshake 完成TLS握手并记录对端身份, 非TLS连接直接返回
+func (c *Conn) handshake() error {
+	tlsConn, ok := c.Conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.peer = newPeerIdentity(tlsConn.ConnectionState())
+	return nil
+}
+
+// PeerIdentity TLS对端身份, 非TLS连接返回nil.
+// 服务端在读取第一个数据包前完成握手, handler中总能拿到对端身份
+func (c *Conn) PeerIdentity() *PeerIdentity {
+	return c.peer
+}
+
+// PeerIdentity 服务端的TLS身份, 未连接或非TLS连接返回nil
+func (c *Client) PeerIdentity() *PeerIdentity {
+	conn, err := c.current()
+	if err != nil {
+		return nil
+	}
+	return conn.PeerIdentity()
+}
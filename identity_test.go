@@ -0,0 +1,86 @@
+package snet
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"slices"
+	"testing"
+
+	"github.com/laazua/snet/certgen"
+)
+
+func TestPeerIdentityFromCertificate(t *testing.T) {
+	ca, err := certgen.NewCA(certgen.Options{CommonName: "test ca"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ca.IssueClient(certgen.Options{
+		CommonName: "worker",
+		Hosts:      []string{"worker.example", "ops@example.com", "10.0.0.1", "spiffe://example.org/worker"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := newPeerIdentity(tls.ConnectionState{
+		Version:          tls.VersionTLS13,
+		CipherSuite:      tls.TLS_AES_128_GCM_SHA256,
+		PeerCertificates: []*x509.Certificate{cert.Cert},
+	})
+	if id.CommonName != "worker" || id.Certificate() != cert.Cert {
+		t.Fatalf("CN %q", id.CommonName)
+	}
+	if id.SPIFFEID != "spiffe://example.org/worker" {
+		t.Fatalf("SPIFFE ID %q", id.SPIFFEID)
+	}
+	want := []string{"worker.example", "ops@example.com", "10.0.0.1", "spiffe://example.org/worker"}
+	if sans := id.SANs(); !slices.Equal(sans, want) {
+		t.Fatalf("SANs %v, want %v", sans, want)
+	}
+	if id.TLSVersionName() != "TLS 1.3" || id.CipherSuiteName() != "TLS_AES_128_GCM_SHA256" {
+		t.Fatalf("version %q suite %q", id.TLSVersionName(), id.CipherSuiteName())
+	}
+
+	if id := newPeerIdentity(tls.ConnectionState{}); id.Certificate() != nil || id.CommonName != "" {
+		t.Fatal("identity without a certificate")
+	}
+}
+
+func TestPeerIdentityOverTLS(t *testing.T) {
+	server, client := certManagers(t, "127.0.0.1")
+	useCertManagers(t, server, client)
+
+	peers := make(chan *PeerIdentity, 1)
+	s := NewServer("")
+	s.AddHandlerFunc(PacketTypeChat, func(conn *Conn, packet *Packet) {})
+	s.OnConnect(func(conn *Conn) { peers <- conn.PeerIdentity() })
+	c := dialClient(t, startServer(t, s))
+
+	// 握手在OnConnect之前完成
+	peer := <-peers
+	if peer == nil || peer.CommonName != "client" || len(peer.Chain) != 2 {
+		t.Fatalf("server sees client %+v", peer)
+	}
+	if peer.TLSVersion < tls.VersionTLS12 {
+		t.Fatalf("TLS version %x", peer.TLSVersion)
+	}
+	serverID := c.PeerIdentity()
+	if serverID == nil || serverID.CommonName != "server" || !slices.Contains(serverID.SANs(), "127.0.0.1") {
+		t.Fatalf("client sees server %+v", serverID)
+	}
+}
+
+func TestPeerIdentityPlaintext(t *testing.T) {
+	peers := make(chan *PeerIdentity, 1)
+	s := NewServer("")
+	s.AddHandlerFunc(PacketTypeChat, func(conn *Conn, packet *Packet) {})
+	s.OnConnect(func(conn *Conn) { peers <- conn.PeerIdentity() })
+	c := dialClient(t, startServer(t, s))
+
+	if peer := <-peers; peer != nil {
+		t.Fatalf("plaintext connection has identity %+v", peer)
+	}
+	if c.PeerIdentity() != nil {
+		t.Fatal("plaintext client has server identity")
+	}
+}
@@ -0,0 +1,220 @@
+package snet
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// CloseReason 连接关闭原因, 可通过PacketTypeDisconnect告知对端
+type CloseReason uint8
+
+const (
+	CloseUnknown       CloseReason = iota // 未知原因
+	CloseNormal                           // 正常关闭
+	CloseEOF                              // 对端断开连接
+	CloseTimeout                          // 读超时
+	CloseProtocolError                    // 协议错误, 如魔数、校验和或长度不合法
+	CloseShutdown                         // 服务器停止
+	CloseEvicted                          // 被服务端踢下线, 见ConnManager.Evict
+	CloseAuthTimeout                      // 未在宽限期内完成认证
+	CloseLimitExceeded                    // 超出限流、内存预算或发送队列限制
+	CloseNetworkError                     // 其他网络错误
+)
+
+var closeReasonNames = [...]string{
+	CloseUnknown:       "unknown",
+	CloseNormal:        "normal",
+	CloseEOF:           "eof",
+	CloseTimeout:       "timeout",
+	CloseProtocolError: "protocol error",
+	CloseShutdown:      "shutdown",
+	CloseEvicted:       "evicted",
+	CloseAuthTimeout:   "auth timeout",
+	CloseLimitExceeded: "limit exceeded",
+	CloseNetworkError:  "network error",
+}
+
+func (r CloseReason) String() string {
+	if int(r) < len(closeReasonNames) {
+		return closeReasonNames[r]
+	}
+	return "unknown"
+}
+
+// closeReasonOf 按读取错误推断关闭原因
+func closeReasonOf(err error) CloseReason {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return CloseEOF
+	case isProtocolError(err):
+		return CloseProtocolError
+	case errors.Is(err, ErrMemoryExhausted):
+		return CloseLimitExceeded
+	case errors.Is(err, ErrConnClosed), errors.Is(err, net.ErrClosed):
+		return CloseNormal
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return CloseTimeout
+	default:
+		return CloseNetworkError
+	}
+}
+
+// isProtocolError 是否为对端发送了不合法数据包导致的错误
+func isProtocolError(err error) bool {
+	return errors.Is(err, ErrMagicNumberInvalid) ||
+		errors.Is(err, ErrProtocolVersion) ||
+		errors.Is(err, ErrPacketIvalid) ||
+		errors.Is(err, ErrPacketTooLarge)
+}
+
+// disconnectReason 解析PacketTypeDisconnect携带的关闭原因, 数据部分的第一个字节为原因
+func disconnectReason(packet *Packet) CloseReason {
+	if len(packet.Data) == 0 {
+		return CloseNormal
+	}
+	return CloseReason(packet.Data[0])
+}
+
+// disconnectTimeout 关闭前等待写锁或发送队列空间、以及同步写出PacketTypeDisconnect的最长时间
+const disconnectTimeout = time.Second
+
+// setCloseReason 记录关闭原因, 只有第一次记录生效
+func (c *Conn) setCloseReason(reason CloseReason) {
+	c.closeReason.CompareAndSwap(uint32(CloseUnknown), uint32(reason))
+}
+
+// CloseReason 连接的关闭原因, 连接未关闭时为CloseUnknown
+func (c *Conn) CloseReason() CloseReason {
+	return CloseReason(c.closeReason.Load())
+}
+
+// Disconnect 向对端发送携带关闭原因的PacketTypeDisconnect后关闭连接.
+// 等待写锁或发送队列空间最多1秒, 超时则不发送直接关闭; 同步发送时写出也最多等待1秒,
+// 启用异步发送时Close会等待写协程写出队列中剩余的数据, 这部分受连接的写超时约束
+func (c *Conn) Disconnect(reason CloseReason) error {
+	c.setCloseReason(reason)
+	packet := NewPacket(PacketTypeDisconnect, []byte{byte(reason)}, 0)
+	priority := c.priorities.of(packet)
+	if data, err := c.encoder.encode(packet); err == nil {
+		if c.aw != nil {
+			c.aw.offer(priority, data, disconnectTimeout, false)
+		} else if c.wl.lockTimeout(priority, disconnectTimeout) {
+			c.Conn.SetWriteDeadline(time.Now().Add(disconnectTimeout))
+			if _, err = c.Conn.Write(data); err == nil {
+				c.metrics.sent(data)
+			}
+			c.wl.unlock()
+		}
+	}
+	return c.Close()
+}
+
+// lifecycleHooks 连接生命周期回调
+type lifecycleHooks struct {
+	mu            sync.RWMutex
+	onConnect     func(conn *Conn)
+	onAuth        func(conn *Conn, principal *Principal)
+	onClose       func(conn *Conn, reason CloseReason)
+	onPacketError func(conn *Conn, packet *Packet, err error)
+}
+
+// connected 连接建立
+func (h *lifecycleHooks) connected(conn *Conn) {
+	h.mu.RLock()
+	fn := h.onConnect
+	h.mu.RUnlock()
+	if fn != nil {
+		fn(conn)
+	}
+}
+
+// authenticated 连接认证通过
+func (h *lifecycleHooks) authenticated(conn *Conn, principal *Principal) {
+	h.mu.RLock()
+	fn := h.onAuth
+	h.mu.RUnlock()
+	if fn != nil {
+		fn(conn, principal)
+	}
+}
+
+// closed 连接关闭
+func (h *lifecycleHooks) closed(conn *Conn) {
+	h.mu.RLock()
+	fn := h.onClose
+	h.mu.RUnlock()
+	if fn != nil {
+		fn(conn, conn.CloseReason())
+	}
+}
+
+// packetError 数据包读取或处理失败
+func (h *lifecycleHooks) packetError(conn *Conn, packet *Packet, err error) {
+	h.mu.RLock()
+	fn := h.onPacketError
+	h.mu.RUnlock()
+	if fn != nil {
+		fn(conn, packet, err)
+	}
+}
+
+// OnConnect 设置连接建立后的回调, 在连接的读协程中同步执行, 返回后才开始读取数据包
+func (s *Server) OnConnect(fn func(conn *Conn)) *Server {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+	s.hooks.onConnect = fn
+	return s
+}
+
+// OnAuthenticate 设置连接认证通过后的回调, 需先调用SetAuthenticator启用认证
+func (s *Server) OnAuthenticate(fn func(conn *Conn, principal *Principal)) *Server {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+	s.hooks.onAuth = fn
+	return s
+}
+
+// OnClose 设置连接关闭后的回调, 此时连接已从ConnManager移除
+func (s *Server) OnClose(fn func(conn *Conn, reason CloseReason)) *Server {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+	s.hooks.onClose = fn
+	return s
+}
+
+// OnPacketError 设置数据包出错的回调: 读取到不合法数据包时packet为nil, 随后连接以CloseProtocolError关闭;
+// 数据包被拒绝、没有handler或协程池队列已满时packet为该数据包
+func (s *Server) OnPacketError(fn func(conn *Conn, packet *Packet, err error)) *Server {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+	s.hooks.onPacketError = fn
+	return s
+}
+
+// OnConnect 设置连接建立后的回调, Connect和Reconnect成功后执行
+func (c *Client) OnConnect(fn func(conn *Conn)) *Client {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	c.hooks.onConnect = fn
+	return c
+}
+
+// OnClose 设置连接关闭后的回调, 服务端通过PacketTypeDisconnect告知的原因优先
+func (c *Client) OnClose(fn func(conn *Conn, reason CloseReason)) *Client {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	c.hooks.onClose = fn
+	return c
+}
+
+// OnPacketError 设置读取到不合法数据包的回调, 随后连接以CloseProtocolError关闭
+func (c *Client) OnPacketError(fn func(conn *Conn, packet *Packet, err error)) *Client {
+	c.hooks.mu.Lock()
+	defer c.hooks.mu.Unlock()
+	c.hooks.onPacketError = fn
+	return c
+}
@@ -0,0 +1,166 @@
+package snet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// packetErr OnPacketError收到的参数
+type packetErr struct {
+	packet *Packet
+	err    error
+}
+
+// hookServer 记录关闭原因和数据包错误的服务器, 只处理PacketTypeChat
+func hookServer(t *testing.T) (*Server, chan CloseReason, chan packetErr) {
+	t.Helper()
+	s := NewServer("")
+	s.AddHandlerFunc(PacketTypeChat, func(conn *Conn, packet *Packet) {
+		conn.SendPacket(NewPacket(PacketTypeChat, packet.Data, packet.Header.Seq))
+	})
+	reasons := make(chan CloseReason, 1)
+	errs := make(chan packetErr, 1)
+	s.OnClose(func(conn *Conn, reason CloseReason) { reasons <- reason })
+	s.OnPacketError(func(conn *Conn, packet *Packet, err error) { errs <- packetErr{packet, err} })
+	return s, reasons, errs
+}
+
+// expectReason 等待并检查关闭原因
+func expectReason(t *testing.T, reasons chan CloseReason, want CloseReason) {
+	t.Helper()
+	select {
+	case reason := <-reasons:
+		if reason != want {
+			t.Fatalf("closed with %v, want %v", reason, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("connection not closed, want %v", want)
+	}
+}
+
+func TestCloseReasonEOF(t *testing.T) {
+	s, reasons, _ := hookServer(t)
+	connected := make(chan struct{}, 1)
+	s.OnConnect(func(conn *Conn) { connected <- struct{}{} })
+	raw, err := net.Dial("tcp", startServer(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-connected
+	raw.Close()
+	expectReason(t, reasons, CloseEOF)
+}
+
+func TestCloseReasonTimeout(t *testing.T) {
+	s, reasons, _ := hookServer(t)
+	s.OnConnect(func(conn *Conn) { conn.SetTimeout(50*time.Millisecond, time.Second) })
+	raw, err := net.Dial("tcp", startServer(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	expectReason(t, reasons, CloseTimeout)
+}
+
+func TestCloseReasonProtocolError(t *testing.T) {
+	s, reasons, errs := hookServer(t)
+	raw, err := net.Dial("tcp", startServer(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	if _, err := raw.Write(make([]byte, HeaderSize)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-errs:
+		if e.packet != nil || !errors.Is(e.err, ErrMagicNumberInvalid) {
+			t.Fatalf("OnPacketError(%v, %v), want nil packet and ErrMagicNumberInvalid", e.packet, e.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnPacketError not called")
+	}
+	expectReason(t, reasons, CloseProtocolError)
+
+	// 关闭前服务端告知原因
+	raw.SetReadDeadline(time.Now().Add(5 * time.Second))
+	packet, err := (&defaultDecoder{}).decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet.Header.Type != PacketTypeDisconnect || disconnectReason(packet) != CloseProtocolError {
+		t.Fatalf("got type %d reason %v, want disconnect with %v", packet.Header.Type, disconnectReason(packet), CloseProtocolError)
+	}
+	if _, err := io.Copy(io.Discard, raw); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPacketErrorNoHandler(t *testing.T) {
+	s, _, errs := hookServer(t)
+	c := dialClient(t, startServer(t, s))
+	if err := c.Send(PacketTypeFile, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-errs:
+		if e.packet == nil || e.packet.Header.Type != PacketTypeFile || !errors.Is(e.err, ErrHandlerNotFound) {
+			t.Fatalf("OnPacketError(%v, %v), want the file packet and ErrHandlerNotFound", e.packet, e.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnPacketError not called")
+	}
+	// 没有handler不断开连接
+	if _, err := c.Request(context.Background(), PacketTypeChat, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCloseReasonShutdown(t *testing.T) {
+	s, reasons, _ := hookServer(t)
+	c := NewClient(startServer(t, s))
+	clientReasons := closeReasons(c)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitFor(t, "connection registered", func() bool { return s.ConnManager().Count() == 1 })
+
+	s.Stop()
+	expectReason(t, reasons, CloseShutdown)
+	// 客户端收到服务端发送的原因
+	expectReason(t, clientReasons, CloseShutdown)
+}
+
+func TestCloseReasonAuthTimeout(t *testing.T) {
+	s, reasons, _ := hookServer(t)
+	s.SetAuthenticator(NewStaticTokenAuthenticator(nil), AuthConfig{GracePeriod: 50 * time.Millisecond})
+	c := NewClient(startServer(t, s))
+	clientReasons := closeReasons(c)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	expectReason(t, reasons, CloseAuthTimeout)
+	expectReason(t, clientReasons, CloseAuthTimeout)
+}
+
+func TestClientCloseReasonNormal(t *testing.T) {
+	s, reasons, _ := hookServer(t)
+	c := NewClient(startServer(t, s))
+	clientReasons := closeReasons(c)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	expectReason(t, reasons, CloseNormal)
+	expectReason(t, clientReasons, CloseNormal)
+}
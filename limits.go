@@ -0,0 +1,186 @@
+package snet
+
+import (
+	"sync"
+	"time"
+)
+
+// ReadLimits 服务端读取数据包的资源限制
+type ReadLimits struct {
+	MaxPacketSize  int                // 数据包数据部分的最大长度, 默认且最大为MaxPacketSize
+	MaxPacketSizes map[PacketType]int // 各包类型的最大长度, 覆盖MaxPacketSize
+	BodyTimeout    time.Duration      // 读取单个数据包数据部分的最长时间, 默认60秒
+	MinBodyRate    int                // 数据部分的最低传输速率(字节/秒), 0表示只受BodyTimeout约束
+	ConnMemory     int                // 每个连接已读取但未处理完的数据上限, 包括流中未被Recv读取的消息, 默认4倍MaxPacketSize
+	MaxInflight    int64              // 所有连接已读取但未处理完的数据上限, 包括流中未被Recv读取的消息, 0表示不限制
+}
+
+// withDefaults 填充默认值
+func (l ReadLimits) withDefaults() ReadLimits {
+	if l.MaxPacketSize <= 0 || l.MaxPacketSize > MaxPacketSize {
+		l.MaxPacketSize = MaxPacketSize
+	}
+	if l.BodyTimeout <= 0 {
+		l.BodyTimeout = 60 * time.Second
+	}
+	if l.ConnMemory <= 0 {
+		l.ConnMemory = 4 * l.MaxPacketSize
+	}
+	return l
+}
+
+// defaultReadLimits 默认的读取限制
+var defaultReadLimits = ReadLimits{}.withDefaults()
+
+// maxSize 包类型允许的最大长度
+func (l *ReadLimits) maxSize(packetType PacketType) uint32 {
+	size, ok := l.MaxPacketSizes[packetType]
+	if !ok || size > MaxPacketSize {
+		size = l.MaxPacketSize
+	}
+	return uint32(size)
+}
+
+// bodyTimeout 读取length字节数据部分的时限
+func (l *ReadLimits) bodyTimeout(length uint32) time.Duration {
+	if l.MinBodyRate <= 0 {
+		return l.BodyTimeout
+	}
+	// 留出1秒应对网络抖动, 之后按最低速率计算
+	timeout := time.Second + time.Duration(float64(length)/float64(l.MinBodyRate)*float64(time.Second))
+	return min(timeout, l.BodyTimeout)
+}
+
+// memoryBudget 内存预算, 超出时等待其他数据包处理完释放
+type memoryBudget struct {
+	limit int64
+	mu    sync.Mutex
+	used  int64
+	freed chan struct{} // 每次释放时关闭并替换, 唤醒所有等待者
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &memoryBudget{limit: limit, freed: make(chan struct{})}
+}
+
+// acquire 占用n字节, 预算不足时等待到timeout或连接关闭
+func (b *memoryBudget) acquire(n int64, timeout time.Duration, closed <-chan struct{}) error {
+	if b == nil || n == 0 {
+		return nil
+	}
+	if n > b.limit {
+		return ErrPacketTooLarge
+	}
+
+	var timer *time.Timer
+	for {
+		b.mu.Lock()
+		if b.used+n <= b.limit {
+			b.used += n
+			b.mu.Unlock()
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil
+		}
+		freed := b.freed
+		b.mu.Unlock()
+
+		if timer == nil {
+			timer = time.NewTimer(timeout)
+		}
+		select {
+		case <-freed:
+		case <-timer.C:
+			return ErrMemoryExhausted
+		case <-closed:
+			timer.Stop()
+			return ErrConnClosed
+		}
+	}
+}
+
+// release 释放n字节
+func (b *memoryBudget) release(n int64) {
+	if b == nil || n == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	close(b.freed)
+	b.freed = make(chan struct{})
+	b.mu.Unlock()
+}
+
+// packetReader 按读取限制接收数据包, 每个连接一个
+type packetReader struct {
+	conn     *Conn
+	limits   *ReadLimits
+	budget   *memoryBudget // 连接的内存预算
+	inflight *memoryBudget // 服务器全局的内存预算, 可为nil
+}
+
+func newPacketReader(conn *Conn, limits *ReadLimits, inflight *memoryBudget) *packetReader {
+	return &packetReader{
+		conn:     conn,
+		limits:   limits,
+		budget:   newMemoryBudget(int64(limits.ConnMemory)),
+		inflight: inflight,
+	}
+}
+
+// receive 读取数据包. 数据部分有独立的读超时, 读取前先占用内存预算,
+// 数据包处理完后需调用Packet.free释放
+func (r *packetReader) receive() (*Packet, error) {
+	c := r.conn
+	if c.readTimeout > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+	header, err := readHeader(c.Conn)
+	if err != nil {
+		return nil, err
+	}
+	if header.Length > r.limits.maxSize(header.Type) {
+		return nil, ErrPacketTooLarge
+	}
+
+	n := int64(header.Length)
+	if err := r.budget.acquire(n, r.limits.BodyTimeout, c.closed); err != nil {
+		return nil, err
+	}
+	if err := r.inflight.acquire(n, r.limits.BodyTimeout, c.closed); err != nil {
+		r.budget.release(n)
+		return nil, err
+	}
+	release := func() {
+		r.budget.release(n)
+		r.inflight.release(n)
+	}
+
+	c.Conn.SetReadDeadline(time.Now().Add(r.limits.bodyTimeout(header.Length)))
+	data, err := readBody(c.Conn, header.Length)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	packet, err := checkPacket(header, data)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	packet.release = release
+	return packet, nil
+}
+
+// SetReadLimits 设置读取数据包的资源限制
+func (s *Server) SetReadLimits(limits ReadLimits) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	limits = limits.withDefaults()
+	s.readLimits = &limits
+	s.inflight = newMemoryBudget(limits.MaxInflight)
+	return s
+}
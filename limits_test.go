@@ -0,0 +1,177 @@
+package snet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// usedBytes 预算当前占用的字节数
+func (b *memoryBudget) usedBytes() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+func TestStreamBufferChargedUntilRecv(t *testing.T) {
+	recv := make(chan struct{})
+	done := make(chan struct{})
+	s := NewServer("").SetReadLimits(ReadLimits{MaxInflight: 64 * MaxPacketSize})
+	s.AddStreamHandlerFunc(PacketTypeVideo, func(stream *Stream) {
+		defer close(done)
+		<-recv
+		for {
+			if _, err := stream.Recv(); err != nil {
+				return
+			}
+		}
+	})
+	c := dialClient(t, startServer(t, s))
+
+	stream, err := c.OpenStream(context.Background(), PacketTypeVideo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 一条完整的消息和一条重组中的消息
+	msg := make([]byte, 3*streamFrameSize)
+	if err := stream.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+	want := int64(len(msg) + streamFrameSize)
+	if err := stream.sendFrame(PacketTypeVideo, flagStreamMore, msg[:streamFrameSize]); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "stream data to be charged", func() bool { return s.inflight.usedBytes() == want })
+
+	close(recv)
+	waitFor(t, "first message to be released", func() bool { return s.inflight.usedBytes() == streamFrameSize })
+
+	// 流结束后未读完的分片不再占用预算
+	stream.Cancel()
+	<-done
+	waitFor(t, "partial message to be released", func() bool { return s.inflight.usedBytes() == 0 })
+}
+
+func TestStreamBufferReleasedOnClose(t *testing.T) {
+	s := NewServer("").SetReadLimits(ReadLimits{MaxInflight: 64 * MaxPacketSize})
+	s.AddStreamHandlerFunc(PacketTypeVideo, func(stream *Stream) {
+		<-stream.Context().Done()
+	})
+	c := dialClient(t, startServer(t, s))
+
+	stream, err := c.OpenStream(context.Background(), PacketTypeVideo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 4 {
+		if err := stream.Send(make([]byte, streamFrameSize)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "stream data to be charged", func() bool { return s.inflight.usedBytes() == 4*streamFrameSize })
+
+	c.Close()
+	waitFor(t, "budget to be released", func() bool { return s.inflight.usedBytes() == 0 })
+}
+
+// rawPacket 编码后的数据包, 用于逐字节控制发送
+func rawPacket(t *testing.T, packetType PacketType, data []byte) []byte {
+	t.Helper()
+	b, err := (&defaultEncoder{}).encode(NewPacket(packetType, data, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSlowBodyClosed(t *testing.T) {
+	s, reasons, _ := hookServer(t)
+	s.SetReadLimits(ReadLimits{BodyTimeout: 100 * time.Millisecond})
+	raw, err := net.Dial("tcp", startServer(t, s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+
+	// 只发送包头和部分数据, 读取数据部分超时后连接被关闭
+	packet := rawPacket(t, PacketTypeChat, make([]byte, 100))
+	if _, err := raw.Write(packet[:HeaderSize+10]); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	expectReason(t, reasons, CloseTimeout)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("slow body held the connection for %v", elapsed)
+	}
+}
+
+func TestBodyTimeoutByRate(t *testing.T) {
+	limits := ReadLimits{BodyTimeout: time.Minute, MinBodyRate: 1024}.withDefaults()
+	if got := limits.bodyTimeout(10 * 1024); got != 11*time.Second {
+		t.Fatalf("bodyTimeout(10KiB) = %v, want 11s", got)
+	}
+	if got := limits.bodyTimeout(MaxPacketSize); got != time.Minute {
+		t.Fatalf("bodyTimeout(max) = %v, want capped at 1m", got)
+	}
+	if got := defaultReadLimits.bodyTimeout(MaxPacketSize); got != 60*time.Second {
+		t.Fatalf("default bodyTimeout = %v", got)
+	}
+}
+
+func TestPacketSizeByType(t *testing.T) {
+	s, reasons, _ := hookServer(t)
+	s.SetReadLimits(ReadLimits{MaxPacketSizes: map[PacketType]int{PacketTypeChat: 16}})
+	c := dialClient(t, startServer(t, s))
+
+	if err := c.Send(PacketTypeChat, make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Receive(); err != nil {
+		t.Fatalf("packet at the limit: %v", err)
+	}
+	// 超出该类型上限的包在读取数据部分之前被拒绝
+	if err := c.Send(PacketTypeChat, make([]byte, 17)); err != nil {
+		t.Fatal(err)
+	}
+	expectReason(t, reasons, CloseProtocolError)
+}
+
+func TestMemoryBudget(t *testing.T) {
+	b := newMemoryBudget(100)
+	closed := make(chan struct{})
+	if err := b.acquire(101, time.Second, closed); !errors.Is(err, ErrPacketTooLarge) {
+		t.Fatalf("acquire over limit: %v", err)
+	}
+	if err := b.acquire(80, time.Second, closed); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.acquire(40, 20*time.Millisecond, closed); !errors.Is(err, ErrMemoryExhausted) {
+		t.Fatalf("acquire when exhausted: %v", err)
+	}
+
+	// 释放后唤醒等待者
+	done := make(chan error, 1)
+	go func() { done <- b.acquire(40, 5*time.Second, closed) }()
+	time.Sleep(10 * time.Millisecond)
+	b.release(50)
+	if err := <-done; err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+	if used := b.usedBytes(); used != 70 {
+		t.Fatalf("used %d, want 70", used)
+	}
+
+	go func() { done <- b.acquire(40, 5*time.Second, closed) }()
+	close(closed)
+	if err := <-done; !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("acquire after close: %v", err)
+	}
+
+	// 未设置预算时不限制
+	var unlimited *memoryBudget
+	if err := unlimited.acquire(1<<40, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+}
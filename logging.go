@@ -0,0 +1,53 @@
+package snet
+
+import (
+	"log/slog"
+)
+
+// discardLogger 默认的日志记录器, 不输出任何日志
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// orDiscard nil时返回discardLogger
+func orDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return discardLogger
+	}
+	return logger
+}
+
+// setLogger 以base为基础设置带连接ID和远端地址的日志记录器
+func (c *Conn) setLogger(base *slog.Logger) {
+	c.logger = base.With(
+		slog.Uint64("conn_id", c.id),
+		slog.String("remote_addr", c.Conn.RemoteAddr().String()),
+	)
+}
+
+// Logger 带有连接ID和远端地址字段的日志记录器, 供handler记录与连接相关的日志
+func (c *Conn) Logger() *slog.Logger {
+	return c.logger
+}
+
+// packetAttrs 数据包的日志字段
+func packetAttrs(packet *Packet) []any {
+	return []any{
+		slog.Int("packet_type", int(packet.Header.Type)),
+		slog.Uint64("seq", uint64(packet.Header.Seq)),
+	}
+}
+
+// SetLogger 设置日志记录器, 默认不输出日志, nil表示不输出
+func (s *Server) SetLogger(logger *slog.Logger) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logger = orDiscard(logger)
+	return s
+}
+
+// SetLogger 设置日志记录器, 需在Connect前调用, 默认不输出日志, nil表示不输出
+func (c *Client) SetLogger(logger *slog.Logger) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logger = orDiscard(logger)
+	return c
+}
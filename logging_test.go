@@ -0,0 +1,119 @@
+package snet
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+// logEntry 记录的一条日志, attrs包含记录器上附加的字段
+type logEntry struct {
+	level slog.Level
+	msg   string
+	attrs map[string]slog.Value
+}
+
+// logRecorder 记录所有日志的slog.Handler
+type logRecorder struct {
+	mu      *sync.Mutex
+	entries *[]logEntry
+	attrs   []slog.Attr
+}
+
+func newLogRecorder() *logRecorder {
+	return &logRecorder{mu: new(sync.Mutex), entries: new([]logEntry)}
+}
+
+func (h *logRecorder) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *logRecorder) Handle(_ context.Context, r slog.Record) error {
+	entry := logEntry{level: r.Level, msg: r.Message, attrs: make(map[string]slog.Value)}
+	for _, a := range h.attrs {
+		entry.attrs[a.Key] = a.Value.Resolve()
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		entry.attrs[a.Key] = a.Value.Resolve()
+		return true
+	})
+	h.mu.Lock()
+	*h.entries = append(*h.entries, entry)
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *logRecorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &logRecorder{mu: h.mu, entries: h.entries, attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *logRecorder) WithGroup(string) slog.Handler { return h }
+
+// find 返回第一条消息为msg的日志
+func (h *logRecorder) find(msg string) (logEntry, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, entry := range *h.entries {
+		if entry.msg == msg {
+			return entry, true
+		}
+	}
+	return logEntry{}, false
+}
+
+func TestServerLogging(t *testing.T) {
+	logs := newLogRecorder()
+	ids := make(chan uint64, 1)
+	s := NewServer("").SetLogger(slog.New(logs))
+	s.AddHandlerFunc(PacketTypeChat, func(conn *Conn, packet *Packet) {
+		conn.Logger().Info("handled", packetAttrs(packet)...)
+		ids <- conn.ID()
+	})
+	c := dialClient(t, startServer(t, s))
+
+	if err := c.Send(PacketTypeChat, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	id := <-ids
+	if err := c.Send(PacketTypeCommand, nil); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "unhandled packet to be logged", func() bool {
+		_, ok := logs.find("no handler for packet")
+		return ok
+	})
+	c.Close()
+	waitFor(t, "close to be logged", func() bool {
+		_, ok := logs.find("connection closed")
+		return ok
+	})
+
+	if _, ok := logs.find("server started"); !ok {
+		t.Fatal("server start not logged")
+	}
+	// 连接相关的日志都带有连接ID和远端地址
+	for _, msg := range []string{"connection opened", "handled", "no handler for packet", "connection closed"} {
+		entry, ok := logs.find(msg)
+		if !ok {
+			t.Fatalf("%q not logged", msg)
+		}
+		if entry.attrs["conn_id"].Uint64() != id || entry.attrs["remote_addr"].String() == "" {
+			t.Fatalf("%q attrs %v, want conn_id %d", msg, entry.attrs, id)
+		}
+	}
+	if entry, _ := logs.find("no handler for packet"); entry.level != slog.LevelWarn || entry.attrs["packet_type"].Int64() != int64(PacketTypeCommand) {
+		t.Fatalf("unhandled packet entry %+v", entry)
+	}
+	if entry, _ := logs.find("connection closed"); entry.attrs["reason"].String() != CloseNormal.String() {
+		t.Fatalf("close reason %v", entry.attrs["reason"])
+	}
+}
+
+func TestSetLoggerNil(t *testing.T) {
+	s := NewServer("").SetLogger(slog.New(newLogRecorder())).SetLogger(nil)
+	if s.logger != discardLogger {
+		t.Fatal("SetLogger(nil) did not restore the discard logger")
+	}
+	if c := NewClient("").SetLogger(nil); c.logger != discardLogger {
+		t.Fatal("client SetLogger(nil) did not restore the discard logger")
+	}
+}
@@ -1,58 +1,299 @@
 package snet
 
 import (
+	"hash/maphash"
 	"net"
 	"sync"
+	"sync/atomic"
 )
 
-// ConnManager 连接管理器
-type ConnManager struct {
+const (
+	defaultConnShards = 64 // 默认分片数
+	closeWorkers      = 64 // CloseAll并发关闭连接的协程数
+)
+
+// connShard 按连接ID分片的连接索引
+type connShard struct {
+	mu    sync.RWMutex
 	conns map[net.Conn]*Conn
+	byID  map[uint64]*Conn
+	bound map[uint64]string // 连接ID -> 已建立索引的用户标识
+}
+
+// userShard 按用户标识分片的用户索引
+type userShard struct {
 	mu    sync.RWMutex
+	users map[string]map[uint64]*Conn // 用户标识 -> 该用户的连接
+}
+
+// ConnManager 连接管理器, 连接和用户索引分别分片加锁, 以降低大量连接时的锁竞争.
+// 锁顺序: 需要同时持有时先持有连接分片锁, 再持有用户分片锁
+type ConnManager struct {
+	shards    []connShard
+	userParts []userShard
+	mask      uint64
+	seed      maphash.Seed
+	count     atomic.Int64
+
+	hooksMu     sync.RWMutex
+	removeHooks []func(conn *Conn)
 }
 
 // NewConnManager 创建连接管理器
 func NewConnManager() *ConnManager {
-	return &ConnManager{
-		conns: make(map[net.Conn]*Conn),
+	return NewShardedConnManager(defaultConnShards)
+}
+
+// NewShardedConnManager 创建指定分片数的连接管理器, 分片数向上取整为2的幂
+func NewShardedConnManager(shards int) *ConnManager {
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+	cm := &ConnManager{
+		shards:    make([]connShard, n),
+		userParts: make([]userShard, n),
+		mask:      uint64(n - 1),
+		seed:      maphash.MakeSeed(),
 	}
+	for i := range cm.shards {
+		cm.shards[i].conns = make(map[net.Conn]*Conn)
+		cm.shards[i].byID = make(map[uint64]*Conn)
+		cm.shards[i].bound = make(map[uint64]string)
+		cm.userParts[i].users = make(map[string]map[uint64]*Conn)
+	}
+	return cm
+}
+
+// shard 连接ID所在的分片
+func (cm *ConnManager) shard(id uint64) *connShard {
+	return &cm.shards[id&cm.mask]
+}
+
+// userShard 用户标识所在的分片
+func (cm *ConnManager) userShard(userID string) *userShard {
+	return &cm.userParts[maphash.String(cm.seed, userID)&cm.mask]
 }
 
 // Add 添加连接
 func (cm *ConnManager) Add(conn *Conn) {
-	cm.mu.Lock()
-	defer cm.mu.Unlock()
-	cm.conns[conn.Conn] = conn
+	shard := cm.shard(conn.id)
+	shard.mu.Lock()
+	_, exists := shard.byID[conn.id]
+	shard.conns[conn.Conn] = conn
+	shard.byID[conn.id] = conn
+	shard.mu.Unlock()
+
+	if !exists {
+		cm.count.Add(1)
+	}
+
+	conn.session.setOnUser(func() { cm.reindex(conn) })
+	cm.reindex(conn)
 }
 
 // Remove 移除连接
 func (cm *ConnManager) Remove(conn *Conn) {
-	cm.mu.Lock()
-	defer cm.mu.Unlock()
-	delete(cm.conns, conn.Conn)
+	conn.session.setOnUser(nil)
+
+	shard := cm.shard(conn.id)
+	shard.mu.Lock()
+	_, exists := shard.byID[conn.id]
+	delete(shard.conns, conn.Conn)
+	delete(shard.byID, conn.id)
+	cm.unbind(shard, conn.id)
+	shard.mu.Unlock()
+
+	if exists {
+		cm.count.Add(-1)
+		cm.removed(conn)
+	}
+}
+
+// OnRemove 注册连接移除时的回调, 用于清理与连接关联的状态
+func (cm *ConnManager) OnRemove(fn func(conn *Conn)) {
+	cm.hooksMu.Lock()
+	defer cm.hooksMu.Unlock()
+	cm.removeHooks = append(cm.removeHooks, fn)
+}
+
+// removed 执行移除回调
+func (cm *ConnManager) removed(conn *Conn) {
+	cm.hooksMu.RLock()
+	hooks := cm.removeHooks
+	cm.hooksMu.RUnlock()
+
+	for _, fn := range hooks {
+		fn(conn)
+	}
 }
 
-// Get 获取连接
+// reindex 按会话当前的用户标识更新索引
+func (cm *ConnManager) reindex(conn *Conn) {
+	userID := conn.session.UserID()
+
+	shard := cm.shard(conn.id)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if shard.byID[conn.id] != conn || shard.bound[conn.id] == userID {
+		return
+	}
+	cm.unbind(shard, conn.id)
+	if userID == "" {
+		return
+	}
+	shard.bound[conn.id] = userID
+
+	us := cm.userShard(userID)
+	us.mu.Lock()
+	if us.users[userID] == nil {
+		us.users[userID] = make(map[uint64]*Conn)
+	}
+	us.users[userID][conn.id] = conn
+	us.mu.Unlock()
+}
+
+// unbind 移除连接的用户索引, 调用方需持有shard.mu
+func (cm *ConnManager) unbind(shard *connShard, id uint64) {
+	userID, ok := shard.bound[id]
+	if !ok {
+		return
+	}
+	delete(shard.bound, id)
+
+	us := cm.userShard(userID)
+	us.mu.Lock()
+	delete(us.users[userID], id)
+	if len(us.users[userID]) == 0 {
+		delete(us.users, userID)
+	}
+	us.mu.Unlock()
+}
+
+// Get 获取连接, 需逐个查找分片, 已知连接ID时应使用GetByID
 func (cm *ConnManager) Get(conn net.Conn) *Conn {
-	cm.mu.RLock()
-	defer cm.mu.RUnlock()
-	return cm.conns[conn]
+	for i := range cm.shards {
+		shard := &cm.shards[i]
+		shard.mu.RLock()
+		c := shard.conns[conn]
+		shard.mu.RUnlock()
+		if c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// GetByID 按连接ID获取连接
+func (cm *ConnManager) GetByID(id uint64) *Conn {
+	shard := cm.shard(id)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	return shard.byID[id]
+}
+
+// GetByUser 获取用户的所有连接
+func (cm *ConnManager) GetByUser(userID string) []*Conn {
+	us := cm.userShard(userID)
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+	conns := make([]*Conn, 0, len(us.users[userID]))
+	for _, conn := range us.users[userID] {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// ForEach 遍历连接快照, fn返回false时停止, fn中可以安全地收发数据或关闭连接
+func (cm *ConnManager) ForEach(fn func(conn *Conn) bool) {
+	for _, conn := range cm.snapshot() {
+		if !fn(conn) {
+			return
+		}
+	}
+}
+
+// Filter 返回满足条件的连接
+func (cm *ConnManager) Filter(match func(conn *Conn) bool) []*Conn {
+	var conns []*Conn
+	for _, conn := range cm.snapshot() {
+		if match(conn) {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+// snapshot 当前所有连接, 逐个分片加读锁, 不是全局一致的快照
+func (cm *ConnManager) snapshot() []*Conn {
+	conns := make([]*Conn, 0, cm.Count())
+	for i := range cm.shards {
+		shard := &cm.shards[i]
+		shard.mu.RLock()
+		for _, conn := range shard.byID {
+			conns = append(conns, conn)
+		}
+		shard.mu.RUnlock()
+	}
+	return conns
 }
 
-// CloseAll 关闭所有连接
+// CloseAll 以CloseShutdown关闭所有连接. 先逐个分片摘除连接, 再在锁外并发关闭, 避免慢连接阻塞其他连接的关闭
 func (cm *ConnManager) CloseAll() {
-	cm.mu.Lock()
-	defer cm.mu.Unlock()
+	var conns []*Conn
+	for i := range cm.shards {
+		shard := &cm.shards[i]
+		shard.mu.Lock()
+		for id, conn := range shard.byID {
+			cm.unbind(shard, id)
+			conns = append(conns, conn)
+		}
+		shard.conns = make(map[net.Conn]*Conn)
+		shard.byID = make(map[uint64]*Conn)
+		shard.mu.Unlock()
+	}
+	cm.count.Add(-int64(len(conns)))
+
+	work := make(chan *Conn)
+	var wg sync.WaitGroup
+	for range min(len(conns), closeWorkers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for conn := range work {
+				conn.Disconnect(CloseShutdown)
+				cm.removed(conn)
+			}
+		}()
+	}
+	for _, conn := range conns {
+		work <- conn
+	}
+	close(work)
+	wg.Wait()
+}
+
+// Evict 以CloseEvicted断开指定ID的连接, 连接不存在时返回false.
+// 连接关闭后由服务端从管理器中移除
+func (cm *ConnManager) Evict(id uint64) bool {
+	conn := cm.GetByID(id)
+	if conn == nil {
+		return false
+	}
+	conn.Disconnect(CloseEvicted)
+	return true
+}
 
-	for _, conn := range cm.conns {
-		conn.Close()
+// EvictUser 以CloseEvicted断开用户的所有连接, 返回断开的连接数
+func (cm *ConnManager) EvictUser(userID string) int {
+	conns := cm.GetByUser(userID)
+	for _, conn := range conns {
+		conn.Disconnect(CloseEvicted)
 	}
-	cm.conns = make(map[net.Conn]*Conn)
+	return len(conns)
 }
 
 // Count 连接数量
 func (cm *ConnManager) Count() int {
-	cm.mu.RLock()
-	defer cm.mu.RUnlock()
-	return len(cm.conns)
+	return int(cm.count.Load())
 }
@@ -0,0 +1,333 @@
+package snet
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// go test -run=^$ -bench=ConnManager -benchmem
+
+// connIndex 基准测试比较的连接管理器接口
+type connIndex interface {
+	Add(conn *Conn)
+	Remove(conn *Conn)
+	Count() int
+	CloseAll()
+}
+
+// lockedConnManager 分片前的连接管理器: 一把读写锁保护全部索引, CloseAll持锁逐个关闭
+type lockedConnManager struct {
+	mu    sync.RWMutex
+	conns map[net.Conn]*Conn
+	byID  map[uint64]*Conn
+	users map[string]map[uint64]*Conn
+	bound map[uint64]string
+
+	hooksMu     sync.RWMutex
+	removeHooks []func(conn *Conn)
+}
+
+func newLockedConnManager() *lockedConnManager {
+	return &lockedConnManager{
+		conns: make(map[net.Conn]*Conn),
+		byID:  make(map[uint64]*Conn),
+		users: make(map[string]map[uint64]*Conn),
+		bound: make(map[uint64]string),
+	}
+}
+
+func (cm *lockedConnManager) Add(conn *Conn) {
+	cm.mu.Lock()
+	cm.conns[conn.Conn] = conn
+	cm.byID[conn.id] = conn
+	cm.mu.Unlock()
+
+	conn.session.setOnUser(func() { cm.reindex(conn) })
+	cm.reindex(conn)
+}
+
+func (cm *lockedConnManager) Remove(conn *Conn) {
+	conn.session.setOnUser(nil)
+
+	cm.mu.Lock()
+	_, exists := cm.byID[conn.id]
+	delete(cm.conns, conn.Conn)
+	delete(cm.byID, conn.id)
+	cm.unbind(conn.id)
+	cm.mu.Unlock()
+
+	if exists {
+		cm.hooksMu.RLock()
+		hooks := cm.removeHooks
+		cm.hooksMu.RUnlock()
+		for _, fn := range hooks {
+			fn(conn)
+		}
+	}
+}
+
+func (cm *lockedConnManager) reindex(conn *Conn) {
+	userID := conn.session.UserID()
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.byID[conn.id] != conn || cm.bound[conn.id] == userID {
+		return
+	}
+	cm.unbind(conn.id)
+	if userID == "" {
+		return
+	}
+	if cm.users[userID] == nil {
+		cm.users[userID] = make(map[uint64]*Conn)
+	}
+	cm.users[userID][conn.id] = conn
+	cm.bound[conn.id] = userID
+}
+
+func (cm *lockedConnManager) unbind(id uint64) {
+	userID, ok := cm.bound[id]
+	if !ok {
+		return
+	}
+	delete(cm.bound, id)
+	delete(cm.users[userID], id)
+	if len(cm.users[userID]) == 0 {
+		delete(cm.users, userID)
+	}
+}
+
+func (cm *lockedConnManager) Count() int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return len(cm.conns)
+}
+
+func (cm *lockedConnManager) CloseAll() {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	for _, conn := range cm.conns {
+		conn.Close()
+	}
+	cm.conns = make(map[net.Conn]*Conn)
+	cm.byID = make(map[uint64]*Conn)
+	cm.users = make(map[string]map[uint64]*Conn)
+	cm.bound = make(map[uint64]string)
+}
+
+// benchNetConn 不进行任何IO的net.Conn, Close耗时delay以模拟关闭时的网络往返
+type benchNetConn struct {
+	net.Conn
+	delay time.Duration
+}
+
+func (c *benchNetConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (c *benchNetConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *benchNetConn) Close() error {
+	if c.delay > 0 {
+		time.Sleep(c.delay)
+	}
+	return nil
+}
+
+// benchConns 创建n个连接, 每个连接属于一个用户
+func benchConns(n int, delay time.Duration) []*Conn {
+	conns := make([]*Conn, n)
+	for i := range conns {
+		conns[i] = newConn(&benchNetConn{delay: delay})
+		conns[i].session.SetUserID("user" + strconv.Itoa(i%1024))
+	}
+	return conns
+}
+
+var connManagers = []struct {
+	name string
+	new  func() connIndex
+}{
+	{"Locked", func() connIndex { return newLockedConnManager() }},
+	{"Sharded", func() connIndex { return NewConnManager() }},
+}
+
+func BenchmarkConnManagerAddRemove(b *testing.B) {
+	for _, m := range connManagers {
+		b.Run(m.name, func(b *testing.B) {
+			cm := m.new()
+			// 预先放入大量连接, 模拟繁忙的服务器
+			for _, conn := range benchConns(100000, 0) {
+				cm.Add(conn)
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				conns := benchConns(64, 0)
+				i := 0
+				for pb.Next() {
+					conn := conns[i%len(conns)]
+					cm.Add(conn)
+					cm.Remove(conn)
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkConnManagerCount(b *testing.B) {
+	for _, m := range connManagers {
+		b.Run(m.name, func(b *testing.B) {
+			cm := m.new()
+			for _, conn := range benchConns(1000, 0) {
+				cm.Add(conn)
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				conns := benchConns(64, 0)
+				i := 0
+				for pb.Next() {
+					// 一半协程增删连接, 与读取数量的协程竞争
+					if i%2 == 0 {
+						conn := conns[i%len(conns)]
+						cm.Add(conn)
+						cm.Remove(conn)
+					} else {
+						cm.Count()
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkConnManagerCloseAll(b *testing.B) {
+	for _, m := range connManagers {
+		b.Run(m.name, func(b *testing.B) {
+			for b.Loop() {
+				b.StopTimer()
+				cm := m.new()
+				for _, conn := range benchConns(1000, 50*time.Microsecond) {
+					cm.Add(conn)
+				}
+				b.StartTimer()
+				cm.CloseAll()
+			}
+		})
+	}
+}
+
+func TestConnManagerEvict(t *testing.T) {
+	s := NewServer("")
+	s.AddHandlerFunc(PacketTypeChat, func(conn *Conn, packet *Packet) {})
+	connected := make(chan *Conn, 2)
+	s.OnConnect(func(conn *Conn) {
+		conn.Session().SetUserID("alice")
+		connected <- conn
+	})
+	addr := startServer(t, s)
+
+	var reasons []chan CloseReason
+	var conns []*Conn
+	for range 2 {
+		c := NewClient(addr)
+		reasons = append(reasons, closeReasons(c))
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		conns = append(conns, <-connected)
+	}
+
+	if s.ConnManager().Evict(0) {
+		t.Fatal("Evict of unknown id returned true")
+	}
+	if !s.ConnManager().Evict(conns[0].ID()) {
+		t.Fatal("Evict returned false")
+	}
+	if reason := <-reasons[0]; reason != CloseEvicted {
+		t.Fatalf("client saw %v, want %v", reason, CloseEvicted)
+	}
+	waitFor(t, "evicted connection removed", func() bool { return s.ConnManager().Count() == 1 })
+	if n := s.ConnManager().EvictUser("alice"); n != 1 {
+		t.Fatalf("EvictUser evicted %d connections, want 1", n)
+	}
+	if reason := <-reasons[1]; reason != CloseEvicted {
+		t.Fatalf("client saw %v, want %v", reason, CloseEvicted)
+	}
+	waitFor(t, "evicted connections removed", func() bool { return s.ConnManager().Count() == 0 })
+}
+
+func TestNewShardedConnManager(t *testing.T) {
+	for shards, want := range map[int]int{0: 1, 1: 1, 5: 8, 64: 64, 100: 128} {
+		cm := NewShardedConnManager(shards)
+		if len(cm.shards) != want || len(cm.userParts) != want || cm.mask != uint64(want-1) {
+			t.Errorf("NewShardedConnManager(%d): %d shards, mask %d, want %d", shards, len(cm.shards), cm.mask, want)
+		}
+	}
+}
+
+func TestConnManagerConcurrent(t *testing.T) {
+	cm := NewShardedConnManager(4)
+	var removed atomic.Int32
+	cm.OnRemove(func(conn *Conn) { removed.Add(1) })
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conns := benchConns(100, 0)
+			for _, conn := range conns {
+				cm.Add(conn)
+			}
+			// 重复移除只回调一次
+			for _, conn := range conns[:50] {
+				cm.Remove(conn)
+				cm.Remove(conn)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := cm.Count(); n != 400 {
+		t.Fatalf("Count = %d, want 400", n)
+	}
+	if n := removed.Load(); n != 400 {
+		t.Fatalf("OnRemove called %d times, want 400", n)
+	}
+	if n := len(cm.snapshot()); n != 400 {
+		t.Fatalf("snapshot has %d connections, want 400", n)
+	}
+}
+
+func TestConnManagerCloseAll(t *testing.T) {
+	cm := NewShardedConnManager(4)
+	var removed atomic.Int32
+	cm.OnRemove(func(conn *Conn) { removed.Add(1) })
+	conns := benchConns(200, 0)
+	for _, conn := range conns {
+		cm.Add(conn)
+	}
+
+	cm.CloseAll()
+	if n := cm.Count(); n != 0 {
+		t.Fatalf("Count after CloseAll = %d", n)
+	}
+	if n := removed.Load(); n != 200 {
+		t.Fatalf("OnRemove called %d times, want 200", n)
+	}
+	for _, conn := range conns {
+		if reason := conn.CloseReason(); reason != CloseShutdown {
+			t.Fatalf("connection closed with %v, want %v", reason, CloseShutdown)
+		}
+	}
+	if cm.GetByID(conns[0].ID()) != nil || len(cm.GetByUser("user0")) != 0 {
+		t.Fatal("closed connection still indexed")
+	}
+}
@@ -0,0 +1,281 @@
+package snet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxTypeSeries 按包类型统计的最大类型数, 超出的类型合并为type="other",
+// 避免对端以任意包类型制造大量时间序列
+const maxTypeSeries = 256
+
+// decodeErrorKinds 解码错误的分类
+var decodeErrorKinds = [...]struct {
+	err  error
+	kind string
+}{
+	{ErrMagicNumberInvalid, "bad_magic"},
+	{ErrProtocolVersion, "bad_version"},
+	{ErrPacketIvalid, "invalid"},
+	{ErrPacketTooLarge, "too_large"},
+	{ErrMemoryExhausted, "memory_exhausted"},
+	{io.ErrUnexpectedEOF, "truncated"},
+}
+
+// typeMetrics 单个包类型的统计
+type typeMetrics struct {
+	packetsIn  atomic.Uint64
+	bytesIn    atomic.Uint64
+	packetsOut atomic.Uint64
+	bytesOut   atomic.Uint64
+	handler    *histogram // handler执行耗时
+}
+
+func newTypeMetrics() *typeMetrics {
+	return &typeMetrics{handler: newHistogram(defaultBuckets)}
+}
+
+// serverMetrics 服务器的运行指标, 所有方法并发安全且允许接收者为nil
+type serverMetrics struct {
+	accepted     atomic.Uint64
+	rejected     atomic.Uint64
+	closed       [len(closeReasonNames)]atomic.Uint64
+	decodeErrors [len(decodeErrorKinds)]atomic.Uint64
+
+	types    sync.Map // PacketType -> *typeMetrics
+	numTypes atomic.Int32
+	other    *typeMetrics
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{other: newTypeMetrics()}
+}
+
+// forType 包类型的统计, 类型数达到上限后新类型计入other
+func (m *serverMetrics) forType(packetType PacketType) *typeMetrics {
+	if v, ok := m.types.Load(packetType); ok {
+		return v.(*typeMetrics)
+	}
+	if m.numTypes.Load() >= maxTypeSeries {
+		return m.other
+	}
+	v, loaded := m.types.LoadOrStore(packetType, newTypeMetrics())
+	if !loaded {
+		m.numTypes.Add(1)
+	}
+	return v.(*typeMetrics)
+}
+
+// received 读取到数据包
+func (m *serverMetrics) received(packet *Packet) {
+	if m == nil {
+		return
+	}
+	t := m.forType(packet.Header.Type)
+	t.packetsIn.Add(1)
+	t.bytesIn.Add(uint64(HeaderSize + len(packet.Data)))
+}
+
+// sent 写出已编码的数据包, 包类型从协议头中读取
+func (m *serverMetrics) sent(data []byte) {
+	if m == nil || len(data) < HeaderSize {
+		return
+	}
+	// 协议头依次为4字节魔数、1字节版本和2字节包类型
+	t := m.forType(PacketType(binary.BigEndian.Uint16(data[5:7])))
+	t.packetsOut.Add(1)
+	t.bytesOut.Add(uint64(len(data)))
+}
+
+// handled handler执行完一个数据包
+func (m *serverMetrics) handled(packetType PacketType, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.forType(packetType).handler.observe(elapsed)
+}
+
+// decodeError 按分类记录读取数据包的错误, 不属于解码错误的忽略
+func (m *serverMetrics) decodeError(err error) {
+	if m == nil {
+		return
+	}
+	for i, kind := range decodeErrorKinds {
+		if errors.Is(err, kind.err) {
+			m.decodeErrors[i].Add(1)
+			return
+		}
+	}
+}
+
+// connClosed 连接关闭
+func (m *serverMetrics) connClosed(reason CloseReason) {
+	if m == nil || int(reason) >= len(m.closed) {
+		return
+	}
+	m.closed[reason].Add(1)
+}
+
+// typeLabel 包类型指标的标签, 按类型排序, other在最后
+type typeLabel struct {
+	label   string
+	metrics *typeMetrics
+}
+
+func (m *serverMetrics) typeLabels() []typeLabel {
+	var types []PacketType
+	m.types.Range(func(key, _ any) bool {
+		types = append(types, key.(PacketType))
+		return true
+	})
+	slices.Sort(types)
+
+	labels := make([]typeLabel, 0, len(types)+1)
+	for _, packetType := range types {
+		v, _ := m.types.Load(packetType)
+		labels = append(labels, typeLabel{strconv.Itoa(int(packetType)), v.(*typeMetrics)})
+	}
+	return append(labels, typeLabel{"other", m.other})
+}
+
+// promWriter 按Prometheus文本格式输出指标
+type promWriter struct {
+	w *bufio.Writer
+}
+
+// family 输出指标的HELP和TYPE行
+func (p *promWriter) family(name, kind, help string) {
+	p.w.WriteString("# HELP " + name + " " + help + "\n")
+	p.w.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+// sample 输出一个样本, labels形如`type="201"`, 可为空
+func (p *promWriter) sample(name, labels string, value string) {
+	p.w.WriteString(name)
+	if labels != "" {
+		p.w.WriteString("{" + labels + "}")
+	}
+	p.w.WriteString(" " + value + "\n")
+}
+
+func (p *promWriter) uint(name, labels string, value uint64) {
+	p.sample(name, labels, strconv.FormatUint(value, 10))
+}
+
+func (p *promWriter) int(name, labels string, value int) {
+	p.sample(name, labels, strconv.Itoa(value))
+}
+
+// histogram 输出直方图的累计桶、总和与样本数, 耗时以秒为单位
+func (p *promWriter) histogram(name, labels string, h HistogramSnapshot) {
+	prefix := labels
+	if prefix != "" {
+		prefix += ","
+	}
+	var cumulative uint64
+	for i, bound := range h.Bounds {
+		cumulative += h.Counts[i]
+		p.uint(name+"_bucket", prefix+`le="`+seconds(bound)+`"`, cumulative)
+	}
+	p.uint(name+"_bucket", prefix+`le="+Inf"`, h.Count)
+	p.sample(name+"_sum", labels, seconds(h.Sum))
+	p.uint(name+"_count", labels, h.Count)
+}
+
+// seconds 以秒为单位格式化时长
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+var taskPriorityNames = [numTaskPriorities]string{"high", "normal", "low"}
+
+// writeMetrics 输出服务器的全部指标
+func (s *Server) writeMetrics(w io.Writer) error {
+	m := s.metrics
+	p := &promWriter{w: bufio.NewWriter(w)}
+
+	p.family("snet_connections_active", "gauge", "Number of open connections.")
+	p.int("snet_connections_active", "", s.connManager.Count())
+	p.family("snet_connections_accepted_total", "counter", "Connections accepted.")
+	p.uint("snet_connections_accepted_total", "", m.accepted.Load())
+	p.family("snet_connections_rejected_total", "counter", "Connections rejected by connection limits.")
+	p.uint("snet_connections_rejected_total", "", m.rejected.Load())
+	p.family("snet_connections_closed_total", "counter", "Connections closed, by close reason.")
+	for reason := range m.closed {
+		if n := m.closed[reason].Load(); n > 0 {
+			p.uint("snet_connections_closed_total", `reason="`+CloseReason(reason).String()+`"`, n)
+		}
+	}
+
+	labels := m.typeLabels()
+	counters := []struct {
+		name, help string
+		value      func(t *typeMetrics) uint64
+	}{
+		{"snet_packets_received_total", "Packets received, by packet type.", func(t *typeMetrics) uint64 { return t.packetsIn.Load() }},
+		{"snet_bytes_received_total", "Bytes received including headers, by packet type.", func(t *typeMetrics) uint64 { return t.bytesIn.Load() }},
+		{"snet_packets_sent_total", "Packets sent, by packet type.", func(t *typeMetrics) uint64 { return t.packetsOut.Load() }},
+		{"snet_bytes_sent_total", "Bytes sent including headers, by packet type.", func(t *typeMetrics) uint64 { return t.bytesOut.Load() }},
+	}
+	for _, c := range counters {
+		p.family(c.name, "counter", c.help)
+		for _, t := range labels {
+			if n := c.value(t.metrics); n > 0 {
+				p.uint(c.name, `type="`+t.label+`"`, n)
+			}
+		}
+	}
+	p.family("snet_handler_duration_seconds", "histogram", "Handler execution time, by packet type.")
+	for _, t := range labels {
+		if h := t.metrics.handler.snapshot(); h.Count > 0 {
+			p.histogram("snet_handler_duration_seconds", `type="`+t.label+`"`, h)
+		}
+	}
+	p.family("snet_decode_errors_total", "counter", "Invalid packets received, by error kind.")
+	for i, kind := range decodeErrorKinds {
+		p.uint("snet_decode_errors_total", `kind="`+kind.kind+`"`, m.decodeErrors[i].Load())
+	}
+
+	pool := s.workerPool.Stats()
+	p.family("snet_pool_workers", "gauge", "Worker goroutines in the pool.")
+	p.int("snet_pool_workers", "", pool.Workers)
+	p.family("snet_pool_busy_workers", "gauge", "Workers executing a task.")
+	p.int("snet_pool_busy_workers", "", pool.Busy)
+	p.family("snet_pool_queue_length", "gauge", "Tasks waiting in the pool queue, by priority.")
+	for i, n := range pool.Queued {
+		p.int("snet_pool_queue_length", `priority="`+taskPriorityNames[i]+`"`, n)
+	}
+	p.family("snet_pool_queue_capacity", "gauge", "Total capacity of the pool queues.")
+	p.int("snet_pool_queue_capacity", "", pool.QueueCap)
+	p.family("snet_pool_tasks_submitted_total", "counter", "Tasks submitted to the pool.")
+	p.uint("snet_pool_tasks_submitted_total", "", pool.Submitted)
+	p.family("snet_pool_tasks_completed_total", "counter", "Tasks completed by the pool.")
+	p.uint("snet_pool_tasks_completed_total", "", pool.Completed)
+	p.family("snet_pool_tasks_rejected_total", "counter", "Tasks rejected because the queue was full or the pool closed.")
+	p.uint("snet_pool_tasks_rejected_total", "", pool.Rejected)
+	p.family("snet_pool_tasks_overrun_total", "counter", "Tasks that exceeded the task timeout.")
+	p.uint("snet_pool_tasks_overrun_total", "", pool.Overrun)
+	p.family("snet_pool_queue_wait_seconds", "histogram", "Time tasks spent waiting in the queue.")
+	p.histogram("snet_pool_queue_wait_seconds", "", pool.QueueWait)
+	p.family("snet_pool_exec_seconds", "histogram", "Task execution time.")
+	p.histogram("snet_pool_exec_seconds", "", pool.Exec)
+
+	return p.w.Flush()
+}
+
+// MetricsHandler 以Prometheus文本格式输出服务器指标的http.Handler:
+// 连接数、按关闭原因的关闭次数、按包类型的收发包数和字节数、handler耗时、解码错误和协程池状态
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		s.writeMetrics(w)
+	})
+}
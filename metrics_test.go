@@ -0,0 +1,189 @@
+package snet
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrape 读取服务器指标文本
+func scrape(t *testing.T, s *Server) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := s.writeMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// hasLine 指标文本中是否有该行
+func hasLine(text, line string) bool {
+	return strings.Contains("\n"+text, "\n"+line+"\n")
+}
+
+func TestMetricsText(t *testing.T) {
+	s := NewServer("")
+	s.AddHandlerFunc(PacketTypeCommand, func(conn *Conn, packet *Packet) {
+		conn.SendPacket(NewPacket(PacketTypeAck, []byte("ok"), packet.Header.Seq))
+	})
+	addr := startServer(t, s)
+
+	c := dialClient(t, addr)
+	for range 3 {
+		if _, err := c.Request(context.Background(), PacketTypeCommand, []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Close()
+
+	raw, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw.Write(make([]byte, HeaderSize))
+	io.Copy(io.Discard, raw)
+	raw.Close()
+
+	waitFor(t, "connections closed", func() bool {
+		text := scrape(t, s)
+		return hasLine(text, `snet_connections_closed_total{reason="normal"} 1`) &&
+			hasLine(text, `snet_connections_closed_total{reason="protocol error"} 1`)
+	})
+	text := scrape(t, s)
+	for _, want := range []string{
+		"# HELP snet_connections_accepted_total Connections accepted.",
+		"# TYPE snet_connections_accepted_total counter",
+		"snet_connections_accepted_total 2",
+		"snet_connections_active 0",
+		`snet_packets_received_total{type="401"} 3`,
+		`snet_bytes_received_total{type="401"} ` + strconv.Itoa(3*(HeaderSize+5)),
+		`snet_packets_sent_total{type="4"} 3`,
+		`snet_bytes_sent_total{type="4"} ` + strconv.Itoa(3*(HeaderSize+2)),
+		"# TYPE snet_handler_duration_seconds histogram",
+		`snet_handler_duration_seconds_bucket{type="401",le="+Inf"} 3`,
+		`snet_handler_duration_seconds_count{type="401"} 3`,
+		`snet_decode_errors_total{kind="bad_magic"} 1`,
+		`snet_decode_errors_total{kind="too_large"} 0`,
+		`snet_pool_queue_length{priority="normal"} 0`,
+	} {
+		if !hasLine(text, want) {
+			t.Errorf("missing line %q", want)
+		}
+	}
+	if t.Failed() {
+		t.Log("\n" + text)
+	}
+
+	rec := httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type %q", ct)
+	}
+}
+
+func TestMetricsHistogramBuckets(t *testing.T) {
+	h := newHistogram([]time.Duration{time.Millisecond, 10 * time.Millisecond})
+	h.observe(500 * time.Microsecond)
+	h.observe(5 * time.Millisecond)
+	h.observe(time.Second)
+
+	var buf bytes.Buffer
+	p := &promWriter{w: bufio.NewWriter(&buf)}
+	p.histogram("x", `type="1"`, h.snapshot())
+	p.w.Flush()
+
+	want := `x_bucket{type="1",le="0.001"} 1
+x_bucket{type="1",le="0.01"} 2
+x_bucket{type="1",le="+Inf"} 3
+x_sum{type="1"} 1.0055
+x_count{type="1"} 3
+`
+	if buf.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestMetricsHandshakeFailureClosed(t *testing.T) {
+	server, client := certManagers(t, "127.0.0.1")
+	useCertManagers(t, server, client)
+	s := NewServer("")
+	s.AddHandlerFunc(PacketTypeChat, func(conn *Conn, packet *Packet) {})
+	addr := startServer(t, s)
+
+	// 明文连接TLS服务器, 握手失败
+	raw, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw.Write(make([]byte, HeaderSize))
+	io.Copy(io.Discard, raw)
+	raw.Close()
+
+	waitFor(t, "closed sample", func() bool {
+		text := scrape(t, s)
+		return strings.Contains(text, "snet_connections_closed_total{")
+	})
+	if text := scrape(t, s); !hasLine(text, "snet_connections_accepted_total 1") {
+		t.Fatalf("accepted not counted:\n%s", text)
+	}
+}
+
+func TestMetricsAsyncSentAfterWrite(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+	conn := newConn(local)
+	conn.metrics = newServerMetrics()
+	conn.startAsyncWriter(AsyncWriteConfig{})
+	defer conn.Close()
+
+	if err := conn.SendPacket(NewPacket(PacketTypeChat, []byte("hi"), 1)); err != nil {
+		t.Fatal(err)
+	}
+	chat := conn.metrics.forType(PacketTypeChat)
+	// 对端未读取, 写协程阻塞在写出上
+	time.Sleep(20 * time.Millisecond)
+	if n := chat.packetsOut.Load(); n != 0 {
+		t.Fatalf("counted %d packets before they were written", n)
+	}
+
+	if _, err := (&defaultDecoder{}).decode(remote); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "sent counted", func() bool { return chat.packetsOut.Load() == 1 })
+	if n := chat.bytesOut.Load(); n != HeaderSize+2 {
+		t.Fatalf("bytes out %d, want %d", n, HeaderSize+2)
+	}
+}
+
+func TestMetricsAsyncSentOverTCP(t *testing.T) {
+	local, remote := tcpPair(t)
+	conn := newConn(local)
+	conn.metrics = newServerMetrics()
+	conn.startAsyncWriter(AsyncWriteConfig{FlushDelay: 20 * time.Millisecond})
+	defer conn.Close()
+
+	// 整批经writev写出后仍按每个数据包计数
+	for range 5 {
+		if err := conn.SendPacket(NewPacket(PacketTypeChat, []byte("hi"), 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remote.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for range 5 {
+		if _, err := (&defaultDecoder{}).decode(remote); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chat := conn.metrics.forType(PacketTypeChat)
+	waitFor(t, "sent counted", func() bool { return chat.packetsOut.Load() == 5 })
+	if n := chat.bytesOut.Load(); n != 5*(HeaderSize+2) {
+		t.Fatalf("bytes out %d, want %d", n, 5*(HeaderSize+2))
+	}
+}
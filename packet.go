@@ -11,9 +11,11 @@ import "hash/crc32"
 
 // 协议常量
 const (
-	MagicNumber     = 0x12345678
-	ProtocolVersion = 1
-	HeaderSize      = 20               // PacketHeader 大小
+	MagicNumber = 0x12345678
+	// ProtocolVersion 协议版本. 版本2在协议头中增加了流ID和流控制标志, 协议头从19字节变为24字节,
+	// 与版本1不兼容, 收到其他版本的数据包时以ErrProtocolVersion关闭连接
+	ProtocolVersion = 2
+	HeaderSize      = 24               // PacketHeader 大小
 	MaxPacketSize   = 10 * 1024 * 1024 // 10MB
 )
 
@@ -25,12 +27,23 @@ type packetHeader struct {
 	Length   uint32     // 数据长度
 	Checksum uint32     // CRC32校验和
 	Seq      uint32     // 序列号
+	Stream   uint32     // 流ID, 0表示不属于任何流
+	Flags    uint8      // 流控制标志
 }
 
 // Packet 数据包结构
 type Packet struct {
-	Header *packetHeader
-	Data   []byte
+	Header  *packetHeader
+	Data    []byte
+	release func() // 释放读取时占用的内存预算
+}
+
+// free 释放读取时占用的内存预算, 由最终处理数据包的一方调用
+func (p *Packet) free() {
+	if p.release != nil {
+		p.release()
+		p.release = nil
+	}
 }
 
 // NewPacket 创建新数据包
@@ -12,6 +12,7 @@ const (
 	PacketTypeDataJson   PacketType = 5 // json数据包
 	PacketTypeDataStruct PacketType = 6 // 结构化数据包
 	PacketTypeError      PacketType = 7 // 错误包
+	PacketTypeChannel    PacketType = 8 // 逻辑通道
 )
 
 // 认证相关包类型 (100-199)
@@ -27,6 +28,9 @@ const (
 	PacketTypeGroupChat    PacketType = 202 // 群聊消息
 	PacketTypeBroadcast    PacketType = 203 // 广播消息
 	PacketTypeNotification PacketType = 204 // 通知
+	PacketTypeSubscribe    PacketType = 205 // 订阅主题
+	PacketTypeUnsubscribe  PacketType = 206 // 取消订阅
+	PacketTypePublish      PacketType = 207 // 发布消息
 )
 
 // 文件相关包类型 (300-399)
@@ -46,6 +50,9 @@ const (
 	PacketTypeQuery   PacketType = 402 // 查询
 	PacketTypeUpdate  PacketType = 403 // 更新
 	PacketTypeConfig  PacketType = 404 // 配置
+
+	PacketTypeRPCRequest  PacketType = 405 // RPC请求
+	PacketTypeRPCResponse PacketType = 406 // RPC响应
 )
 
 // 业务相关包类型 (500-999)
@@ -0,0 +1,263 @@
+package snet
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TypeRange 包类型区间, 包含两端
+type TypeRange struct {
+	Min PacketType
+	Max PacketType
+}
+
+// 与packet_type.go中分类一致的包类型区间
+var (
+	CategorySystem   = TypeRange{0, 99}
+	CategoryAuth     = TypeRange{100, 199}
+	CategoryMessage  = TypeRange{200, 299}
+	CategoryFile     = TypeRange{300, 399}
+	CategoryCommand  = TypeRange{400, 499}
+	CategoryBusiness = TypeRange{500, 999}
+)
+
+// categories 策略文件中可用的分类名称
+var categories = map[string]TypeRange{
+	"system":   CategorySystem,
+	"auth":     CategoryAuth,
+	"message":  CategoryMessage,
+	"file":     CategoryFile,
+	"command":  CategoryCommand,
+	"business": CategoryBusiness,
+	"all":      {0, 0xFFFF},
+}
+
+// Only 只包含单个包类型的区间
+func Only(packetType PacketType) TypeRange {
+	return TypeRange{packetType, packetType}
+}
+
+// Contains 是否包含包类型
+func (r TypeRange) Contains(packetType PacketType) bool {
+	return packetType >= r.Min && packetType <= r.Max
+}
+
+// UnmarshalJSON 支持分类名称("message")、区间("200-299")、单个类型("201")或数字(201)
+func (r *TypeRange) UnmarshalJSON(data []byte) error {
+	var n uint16
+	if err := json.Unmarshal(data, &n); err == nil {
+		*r = Only(PacketType(n))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("snet: invalid packet type range %s", data)
+	}
+	if category, ok := categories[strings.ToLower(s)]; ok {
+		*r = category
+		return nil
+	}
+	lo, hi, isRange := strings.Cut(s, "-")
+	if !isRange {
+		hi = lo
+	}
+	from, err1 := strconv.ParseUint(strings.TrimSpace(lo), 10, 16)
+	to, err2 := strconv.ParseUint(strings.TrimSpace(hi), 10, 16)
+	if err1 != nil || err2 != nil || from > to {
+		return fmt.Errorf("snet: invalid packet type range %q", s)
+	}
+	*r = TypeRange{PacketType(from), PacketType(to)}
+	return nil
+}
+
+// PolicyRule 授权规则.
+// Subjects中的条目: "*"匹配任意已认证身份, "anonymous"匹配未认证连接,
+// "role:<角色>"匹配拥有该角色的身份, "san:<值>"匹配客户端证书的SAN, 其他按身份标识精确匹配
+type PolicyRule struct {
+	Subjects []string    `json:"subjects"`
+	Allow    []TypeRange `json:"allow"`
+	Deny     []TypeRange `json:"deny"`
+}
+
+// matches 规则是否适用于身份, principal为nil表示未认证
+func (rule *PolicyRule) matches(principal *Principal) bool {
+	for _, subject := range rule.Subjects {
+		if principal == nil {
+			if subject == "anonymous" {
+				return true
+			}
+			continue
+		}
+		switch {
+		case subject == "*":
+			return true
+		case strings.HasPrefix(subject, "role:"):
+			if principal.HasRole(strings.TrimPrefix(subject, "role:")) {
+				return true
+			}
+		case strings.HasPrefix(subject, "san:"):
+			if principal.hasSAN(strings.TrimPrefix(subject, "san:")) {
+				return true
+			}
+		case subject == principal.Name:
+			return true
+		}
+	}
+	return false
+}
+
+// Policy 按包类型的授权策略.
+// 适用于身份的所有规则中, 任一规则拒绝则拒绝, 否则任一规则允许则允许;
+// 没有规则作出决定时按Default判断
+type Policy struct {
+	Rules   []PolicyRule `json:"rules"`
+	Default []TypeRange  `json:"default"`
+}
+
+// ParsePolicy 解析JSON格式的授权策略
+func ParsePolicy(data []byte) (*Policy, error) {
+	policy := &Policy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("snet: parse policy: %w", err)
+	}
+	return policy, nil
+}
+
+// LoadPolicy 从JSON文件加载授权策略
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(data)
+}
+
+// Allow 追加允许规则
+func (p *Policy) Allow(subject string, ranges ...TypeRange) *Policy {
+	p.Rules = append(p.Rules, PolicyRule{Subjects: []string{subject}, Allow: ranges})
+	return p
+}
+
+// Deny 追加拒绝规则
+func (p *Policy) Deny(subject string, ranges ...TypeRange) *Policy {
+	p.Rules = append(p.Rules, PolicyRule{Subjects: []string{subject}, Deny: ranges})
+	return p
+}
+
+// Allowed 身份是否可以发送该类型的数据包, principal为nil表示未认证
+func (p *Policy) Allowed(principal *Principal, packetType PacketType) bool {
+	allowed := false
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if !rule.matches(principal) {
+			continue
+		}
+		if inRanges(rule.Deny, packetType) {
+			return false
+		}
+		if inRanges(rule.Allow, packetType) {
+			allowed = true
+		}
+	}
+	return allowed || inRanges(p.Default, packetType)
+}
+
+func inRanges(ranges []TypeRange, packetType PacketType) bool {
+	for _, r := range ranges {
+		if r.Contains(packetType) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditEvent 授权审计事件
+type AuditEvent struct {
+	Conn      *Conn
+	Principal *Principal // 判定所用的身份, 未认证时为nil
+	Type      PacketType
+	Allowed   bool
+}
+
+// AuditFunc 授权审计回调, 每次授权判定都会调用, 需要尽快返回
+type AuditFunc func(event AuditEvent)
+
+// authorizer 服务端授权检查
+type authorizer struct {
+	policy *Policy
+	audit  AuditFunc
+}
+
+// authorize 检查连接能否发送该类型的数据包
+func (a *authorizer) authorize(conn *Conn, packetType PacketType) bool {
+	principal := conn.principal()
+	allowed := a.policy.Allowed(principal, packetType)
+	if a.audit != nil {
+		a.audit(AuditEvent{Conn: conn, Principal: principal, Type: packetType, Allowed: allowed})
+	}
+	return allowed
+}
+
+// principal 连接的身份: 优先使用认证得到的身份, 否则使用TLS客户端证书
+func (c *Conn) principal() *Principal {
+	if principal := c.session.Principal(); principal != nil {
+		return principal
+	}
+	peer := c.PeerIdentity()
+	if peer == nil || peer.Certificate() == nil {
+		return nil
+	}
+	return &Principal{
+		Name:   peer.CommonName,
+		Claims: map[string]any{"san": peer.SANs()},
+	}
+}
+
+// hasSAN 是否拥有该SAN, 来自客户端证书或令牌中的"san"声明
+func (p *Principal) hasSAN(value string) bool {
+	switch sans := p.Claims["san"].(type) {
+	case []string:
+		for _, san := range sans {
+			if san == value {
+				return true
+			}
+		}
+	case []any:
+		for _, san := range sans {
+			if san == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authorize 按授权策略检查数据包, 未被允许时拒绝并返回false
+func (s *Server) authorize(conn *Conn, packet *Packet) bool {
+	s.mu.RLock()
+	authorizer := s.authorizer
+	s.mu.RUnlock()
+
+	if authorizer == nil || authorizer.authorize(conn, packet.Header.Type) {
+		return true
+	}
+	s.reject(conn, packet, ErrPermissionDenied)
+	return false
+}
+
+// SetPolicy 启用按包类型的授权, 未被允许的数据包回复PacketTypeError, 流被重置.
+// audit可为nil; 心跳包以及由认证器处理的登录、认证和登出包不受策略约束.
+// 策略设置后不应再修改, 需要变更时以新的策略再次调用SetPolicy
+func (s *Server) SetPolicy(policy *Policy, audit AuditFunc) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if policy == nil {
+		s.authorizer = nil
+	} else {
+		s.authorizer = &authorizer{policy: policy, audit: audit}
+	}
+	return s
+}
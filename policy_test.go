@@ -0,0 +1,123 @@
+package snet
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPolicyAllowed(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`{
+		"rules": [
+			{"subjects": ["*"], "allow": ["message", "402"]},
+			{"subjects": ["role:admin"], "allow": ["command"]},
+			{"subjects": ["mallory"], "deny": ["200-299"]},
+			{"subjects": ["san:ops.example"], "allow": [403]}
+		],
+		"default": ["system"]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &Principal{Name: "alice"}
+	admin := &Principal{Name: "bob", Roles: []string{"admin"}}
+	mallory := &Principal{Name: "mallory"}
+	ops := &Principal{Name: "ops", Claims: map[string]any{"san": []any{"ops.example"}}}
+
+	for _, tc := range []struct {
+		principal  *Principal
+		packetType PacketType
+		allowed    bool
+	}{
+		{nil, PacketTypeHeartbeat, true},
+		{nil, PacketTypeChat, false},
+		{user, PacketTypeChat, true},
+		{user, PacketTypeQuery, true},
+		{user, PacketTypeCommand, false},
+		{admin, PacketTypeCommand, true},
+		// 拒绝优先于允许
+		{mallory, PacketTypeChat, false},
+		{mallory, PacketTypeQuery, true},
+		{ops, PacketTypeUpdate, true},
+		{user, PacketTypeUpdate, false},
+	} {
+		name := "anonymous"
+		if tc.principal != nil {
+			name = tc.principal.Name
+		}
+		if got := policy.Allowed(tc.principal, tc.packetType); got != tc.allowed {
+			t.Errorf("Allowed(%s, %d) = %v, want %v", name, tc.packetType, got, tc.allowed)
+		}
+	}
+}
+
+func TestTypeRangeUnmarshal(t *testing.T) {
+	for input, want := range map[string]TypeRange{
+		`"message"`:   CategoryMessage,
+		`"FILE"`:      CategoryFile,
+		`"200 - 210"`: {200, 210},
+		`"201"`:       Only(201),
+		`201`:         Only(201),
+	} {
+		var r TypeRange
+		if err := r.UnmarshalJSON([]byte(input)); err != nil || r != want {
+			t.Errorf("%s: got %v, %v, want %v", input, r, err, want)
+		}
+	}
+	for _, input := range []string{`"210-200"`, `"x"`, `true`, `"70000"`} {
+		var r TypeRange
+		if err := r.UnmarshalJSON([]byte(input)); err == nil {
+			t.Errorf("%s: accepted as %v", input, r)
+		}
+	}
+}
+
+func TestServerPolicy(t *testing.T) {
+	s := NewServer("")
+	s.SetAuthenticator(NewStaticTokenAuthenticator(map[string]*Principal{
+		"user":  {Name: "alice"},
+		"admin": {Name: "bob", Roles: []string{"admin"}},
+	}), AuthConfig{})
+	audits := make(chan AuditEvent, 16)
+	s.SetPolicy(new(Policy).
+		Allow("*", CategoryMessage).
+		Allow("role:admin", CategoryCommand), func(event AuditEvent) { audits <- event })
+	for _, packetType := range []PacketType{PacketTypeChat, PacketTypeCommand} {
+		s.AddHandlerFunc(packetType, func(conn *Conn, packet *Packet) {
+			conn.SendPacket(NewPacket(PacketTypeAck, nil, packet.Header.Seq))
+		})
+	}
+	addr := startServer(t, s)
+	ctx := context.Background()
+
+	user, admin := dialClient(t, addr), dialClient(t, addr)
+	if err := user.Login(ctx, []byte("user")); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.Login(ctx, []byte("admin")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := user.requestAck(ctx, PacketTypeChat, nil); err != nil {
+		t.Fatalf("user chat: %v", err)
+	}
+	if err := user.requestAck(ctx, PacketTypeCommand, nil); err == nil || err.Error() != ErrPermissionDenied.Error() {
+		t.Fatalf("user command: %v, want permission denied", err)
+	}
+	if err := admin.requestAck(ctx, PacketTypeCommand, nil); err != nil {
+		t.Fatalf("admin command: %v", err)
+	}
+
+	var denied int
+	for range 3 {
+		event := <-audits
+		if !event.Allowed {
+			denied++
+			if event.Principal.Name != "alice" || event.Type != PacketTypeCommand {
+				t.Fatalf("denied event %+v", event)
+			}
+		}
+	}
+	if denied != 1 {
+		t.Fatalf("%d denied audit events, want 1", denied)
+	}
+}
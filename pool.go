@@ -1,59 +1,496 @@
 package snet
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
+// TaskPriority 任务优先级, 协程空闲时先取高优先级队列中的任务
+type TaskPriority uint8
+
+const (
+	TaskPriorityHigh   TaskPriority = iota // 高优先级: 登录、认证等
+	TaskPriorityNormal                     // 普通优先级: 未指定优先级的任务
+	TaskPriorityLow                        // 低优先级: 可延后处理的批量任务
+
+	numTaskPriorities = 3
+)
+
+// PoolConfig 协程池配置
+type PoolConfig struct {
+	MinWorkers  int           // 常驻协程数, 默认1
+	MaxWorkers  int           // 最大协程数, 不大于MinWorkers时为固定大小
+	QueueSize   int           // 任务队列总容量, 各优先级共享
+	IdleTimeout time.Duration // 超出常驻数量的协程空闲多久后退出, 默认30秒
+	TaskTimeout time.Duration // 任务执行超过该时长时报告, 0表示不检查
+}
+
+// withDefaults 填充默认值
+func (cfg PoolConfig) withDefaults() PoolConfig {
+	if cfg.MinWorkers <= 0 {
+		cfg.MinWorkers = 1
+	}
+	if cfg.MaxWorkers < cfg.MinWorkers {
+		cfg.MaxWorkers = cfg.MinWorkers
+	}
+	if cfg.QueueSize < 0 {
+		cfg.QueueSize = 0
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = 30 * time.Second
+	}
+	return cfg
+}
+
+// poolTask 排队中的任务
+type poolTask struct {
+	run        func()
+	priority   TaskPriority
+	enqueued   time.Time
+	packetType PacketType // 服务器提交的任务对应的包类型
+	connID     uint64     // 服务器提交的任务对应的连接ID
+}
+
+// TaskOverrun 执行超时的任务, 任务不会被中断, 回调时仍在执行
+type TaskOverrun struct {
+	PacketType PacketType    // 包类型, 非服务器提交的任务为0
+	ConnID     uint64        // 连接ID, 非服务器提交的任务为0
+	Started    time.Time     // 开始执行的时间
+	Timeout    time.Duration // 配置的任务超时
+}
+
+// PoolStats 协程池状态
+type PoolStats struct {
+	Workers    int               // 当前协程数
+	MinWorkers int               // 常驻协程数
+	MaxWorkers int               // 最大协程数
+	Busy       int               // 正在执行任务的协程数
+	Idle       int               // 空闲协程数
+	QueueLen   int               // 排队中的任务数
+	QueueCap   int               // 任务队列总容量
+	Queued     []int             // 各优先级排队中的任务数, 按TaskPriority索引
+	Submitted  uint64            // 已提交的任务数
+	Completed  uint64            // 已完成的任务数
+	Rejected   uint64            // 因队列已满或已关闭被拒绝的任务数
+	Overrun    uint64            // 执行超时的任务数
+	QueueWait  HistogramSnapshot // 任务排队耗时
+	Exec       HistogramSnapshot // 任务执行耗时
+}
+
 // WorkerPool 协程池
 type WorkerPool struct {
-	workers   int
-	taskQueue chan func()
-	wg        sync.WaitGroup
-	closed    int32
+	queues      [numTaskPriorities]chan poolTask // 按优先级的任务队列, 容量均为QueueSize
+	slots       chan struct{}                    // 队列总容量的信号量, 入队前占用, 出队后释放; QueueSize为0时为nil
+	skipped     [numTaskPriorities]atomic.Int32  // 队列非空但被更高优先级越过的次数
+	wg          sync.WaitGroup
+	closed      int32
+	quit        chan struct{} // 关闭时关闭, 唤醒等待队列空间的提交方
+	sendMu      sync.RWMutex  // 提交方持读锁发送, Close持写锁关闭队列, 避免向已关闭的队列发送
+	idleTimeout time.Duration
+	taskTimeout time.Duration
+	onOverrun   atomic.Pointer[func(TaskOverrun)]
+
+	busy      atomic.Int64
+	submitted atomic.Uint64
+	completed atomic.Uint64
+	rejected  atomic.Uint64
+	overrun   atomic.Uint64
+	queueWait *histogram
+	exec      *histogram
+
+	mu      sync.Mutex
+	min     int // 常驻协程数
+	max     int // 最大协程数
+	workers int // 当前协程数
 }
 
-// NewWorkerPool 创建协程池
-func newWorkerPool(workers, queueSize int) *WorkerPool {
+// NewWorkerPool 创建协程池, 任务排队或没有空闲协程时在MaxWorkers范围内扩容, 空闲后缩回MinWorkers
+func NewWorkerPool(cfg PoolConfig) *WorkerPool {
+	cfg = cfg.withDefaults()
 	pool := &WorkerPool{
-		workers:   workers,
-		taskQueue: make(chan func(), queueSize),
+		quit:        make(chan struct{}),
+		idleTimeout: cfg.IdleTimeout,
+		taskTimeout: cfg.TaskTimeout,
+		queueWait:   newHistogram(defaultBuckets),
+		exec:        newHistogram(defaultBuckets),
+		min:         cfg.MinWorkers,
+		max:         cfg.MaxWorkers,
+	}
+
+	for i := range pool.queues {
+		pool.queues[i] = make(chan poolTask, cfg.QueueSize)
+	}
+	if cfg.QueueSize > 0 {
+		pool.slots = make(chan struct{}, cfg.QueueSize)
 	}
 
-	for range workers {
-		pool.wg.Add(1)
-		go pool.worker()
+	pool.mu.Lock()
+	for range cfg.MinWorkers {
+		pool.spawn()
 	}
+	pool.mu.Unlock()
 
 	return pool
 }
 
-func (p *WorkerPool) worker() {
+// newWorkerPool 创建固定大小的协程池
+func newWorkerPool(workers, queueSize int) *WorkerPool {
+	return NewWorkerPool(PoolConfig{MinWorkers: workers, MaxWorkers: workers, QueueSize: queueSize})
+}
+
+// spawn 启动一个协程, 调用方需持有p.mu
+func (p *WorkerPool) spawn() {
+	p.workers++
+	p.wg.Add(1)
+	go p.worker(nil)
+}
+
+// retire 当前协程数超出limit时减少计数并返回true, 调用方的协程随后退出
+func (p *WorkerPool) retire(limit func() int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.workers > limit() {
+		p.workers--
+		return true
+	}
+	return false
+}
+
+// worker 协程主循环, first不为nil时先执行该任务
+func (p *WorkerPool) worker(first *poolTask) {
 	defer p.wg.Done()
 
-	for task := range p.taskQueue {
-		task()
+	if first != nil {
+		p.execute(*first)
+	}
+
+	idle := time.NewTimer(p.idleTimeout)
+	defer idle.Stop()
+
+	for {
+		task, ok, closed := p.next(idle.C)
+		switch {
+		case closed:
+			p.retire(func() int { return 0 })
+			return
+		case ok:
+			p.busy.Add(1)
+			p.execute(task)
+			// 缩小上限后多出的协程在完成当前任务后退出
+			if p.retire(func() int { return p.max }) {
+				return
+			}
+		default:
+			if p.retire(func() int { return p.min }) {
+				return
+			}
+		}
+		idle.Reset(p.idleTimeout)
 	}
 }
 
-// Submit 提交任务
+// next 取下一个任务, 没有任务时等待到有任务或空闲超时; 队列已关闭且为空时closed为true
+func (p *WorkerPool) next(idle <-chan time.Time) (task poolTask, ok bool, closed bool) {
+	if task, ok = p.poll(); ok {
+		p.release()
+		return task, true, false
+	}
+	select {
+	case task, ok = <-p.queues[TaskPriorityHigh]:
+	case task, ok = <-p.queues[TaskPriorityNormal]:
+	case task, ok = <-p.queues[TaskPriorityLow]:
+	case <-idle:
+		return task, false, false
+	}
+	if !ok {
+		// 队列已关闭, 取完剩余的任务后退出
+		task, ok = p.poll()
+		if ok {
+			p.release()
+		}
+		return task, ok, !ok
+	}
+	p.release()
+	return task, true, false
+}
+
+// release 任务出队后释放占用的队列容量
+func (p *WorkerPool) release() {
+	if p.slots != nil {
+		<-p.slots
+	}
+}
+
+// poll 不等待地按优先级取任务, 被连续越过starvationLimit次的低优先级队列优先
+func (p *WorkerPool) poll() (poolTask, bool) {
+	for pr := numTaskPriorities - 1; pr > 0; pr-- {
+		if p.skipped[pr].Load() < starvationLimit {
+			continue
+		}
+		select {
+		case task, ok := <-p.queues[pr]:
+			if ok {
+				p.skipped[pr].Store(0)
+				return task, true
+			}
+		default:
+		}
+	}
+
+	for pr := range p.queues {
+		select {
+		case task, ok := <-p.queues[pr]:
+			if !ok {
+				continue
+			}
+			p.skipped[pr].Store(0)
+			for lower := pr + 1; lower < numTaskPriorities; lower++ {
+				if len(p.queues[lower]) > 0 {
+					p.skipped[lower].Add(1)
+				}
+			}
+			return task, true
+		default:
+		}
+	}
+	return poolTask{}, false
+}
+
+// queued 排队中的任务总数
+func (p *WorkerPool) queued() int {
+	n := 0
+	for _, queue := range p.queues {
+		n += len(queue)
+	}
+	return n
+}
+
+// execute 执行任务并记录耗时, 调用方需先增加busy计数
+func (p *WorkerPool) execute(task poolTask) {
+	start := time.Now()
+	p.queueWait.observe(start.Sub(task.enqueued))
+	if p.taskTimeout > 0 {
+		timer := time.AfterFunc(p.taskTimeout, func() {
+			p.overrun.Add(1)
+			if fn := p.onOverrun.Load(); fn != nil {
+				(*fn)(TaskOverrun{
+					PacketType: task.packetType,
+					ConnID:     task.connID,
+					Started:    start,
+					Timeout:    p.taskTimeout,
+				})
+			}
+		})
+		defer timer.Stop()
+	}
+	defer func() {
+		p.busy.Add(-1)
+		p.completed.Add(1)
+		p.exec.observe(time.Since(start))
+	}()
+	task.run()
+}
+
+// handoff 任务无法入队且未达上限时启动新协程直接执行任务.
+// 队列容量为0时任务只能交给正在等待的协程, 不这样扩容协程池将无法超出MinWorkers
+func (p *WorkerPool) handoff(task poolTask) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.workers >= p.max || atomic.LoadInt32(&p.closed) == 1 {
+		return false
+	}
+	p.workers++
+	p.wg.Add(1)
+	p.submitted.Add(1)
+	// 提前计入busy, 避免随后的提交把这个协程当作空闲
+	p.busy.Add(1)
+	go p.worker(&task)
+	return true
+}
+
+// grow 有任务排队且未达上限时扩容
+func (p *WorkerPool) grow() {
+	if p.queued() == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.workers < p.max && atomic.LoadInt32(&p.closed) == 0 {
+		p.spawn()
+	}
+}
+
+// Submit 提交任务, 队列已满时立即返回ErrWorkerPoolQueueFull, 同TrySubmit
 func (p *WorkerPool) Submit(task func()) error {
+	return p.TrySubmit(task)
+}
+
+// TrySubmit 提交任务, 队列已满时立即返回ErrWorkerPoolQueueFull
+func (p *WorkerPool) TrySubmit(task func()) error {
+	return p.submit(context.Background(), poolTask{run: task, priority: TaskPriorityNormal}, false)
+}
+
+// SubmitContext 提交任务, 队列已满时等待空间直到ctx结束, 返回ctx的错误
+func (p *WorkerPool) SubmitContext(ctx context.Context, task func()) error {
+	return p.submit(ctx, poolTask{run: task, priority: TaskPriorityNormal}, true)
+}
+
+// SubmitPriority 以指定优先级提交任务, 队列已满时等待空间直到ctx结束
+func (p *WorkerPool) SubmitPriority(ctx context.Context, priority TaskPriority, task func()) error {
+	return p.submit(ctx, poolTask{run: task, priority: priority}, true)
+}
+
+// submit 提交任务, wait为false时不等待队列空间
+func (p *WorkerPool) submit(ctx context.Context, task poolTask, wait bool) error {
+	p.sendMu.RLock()
+	defer p.sendMu.RUnlock()
+
 	if atomic.LoadInt32(&p.closed) == 1 {
+		p.rejected.Add(1)
 		return ErrWorkerPoolClosed
 	}
 
+	if task.priority >= numTaskPriorities {
+		task.priority = TaskPriorityLow
+	}
+	task.enqueued = time.Now()
+	if err := p.enqueue(ctx, task, wait); err != nil {
+		p.rejected.Add(1)
+		return err
+	}
+	p.grow()
+	return nil
+}
+
+// enqueue 占用队列总容量后将任务放入对应优先级的队列, 队列容量为0时只能交给正在等待任务的协程.
+// 都不成功时尝试扩容, wait为true时等待队列空间.
+// 任务确定被接收后才计入submitted, 被拒绝的提交不会使计数回退
+func (p *WorkerPool) enqueue(ctx context.Context, task poolTask, wait bool) error {
+	queue := p.queues[task.priority]
+	if p.slots == nil {
+		select {
+		case queue <- task:
+			p.submitted.Add(1)
+			return nil
+		default:
+		}
+		if p.handoff(task) {
+			return nil
+		}
+		if !wait {
+			return ErrWorkerPoolQueueFull
+		}
+		select {
+		case queue <- task:
+			p.submitted.Add(1)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.quit:
+			return ErrWorkerPoolClosed
+		}
+	}
+
+	// 每个优先级队列的容量都等于总容量, 占用信号量后入队不会阻塞
 	select {
-	case p.taskQueue <- task:
+	case p.slots <- struct{}{}:
+		p.submitted.Add(1)
+		queue <- task
 		return nil
 	default:
+	}
+	if p.handoff(task) {
+		return nil
+	}
+	if !wait {
 		return ErrWorkerPoolQueueFull
 	}
+	select {
+	case p.slots <- struct{}{}:
+		p.submitted.Add(1)
+		queue <- task
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.quit:
+		return ErrWorkerPoolClosed
+	}
+}
+
+// OnOverrun 设置任务执行超过PoolConfig.TaskTimeout时的回调, 回调在独立协程中执行
+func (p *WorkerPool) OnOverrun(fn func(TaskOverrun)) *WorkerPool {
+	p.onOverrun.Store(&fn)
+	return p
 }
 
-// Close 关闭协程池
+// Resize 运行时调整常驻和最大协程数, 缩容在协程完成当前任务或空闲超时后逐步生效
+func (p *WorkerPool) Resize(minWorkers, maxWorkers int) {
+	cfg := PoolConfig{MinWorkers: minWorkers, MaxWorkers: maxWorkers}.withDefaults()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.min, p.max = cfg.MinWorkers, cfg.MaxWorkers
+	if atomic.LoadInt32(&p.closed) == 1 {
+		return
+	}
+	for p.workers < p.min {
+		p.spawn()
+	}
+}
+
+// Workers 当前协程数
+func (p *WorkerPool) Workers() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.workers
+}
+
+// Stats 协程池状态
+func (p *WorkerPool) Stats() PoolStats {
+	p.mu.Lock()
+	stats := PoolStats{
+		Workers:    p.workers,
+		MinWorkers: p.min,
+		MaxWorkers: p.max,
+	}
+	p.mu.Unlock()
+
+	stats.Busy = int(p.busy.Load())
+	stats.Idle = max(stats.Workers-stats.Busy, 0)
+	stats.Queued = make([]int, numTaskPriorities)
+	for i, queue := range p.queues {
+		stats.Queued[i] = len(queue)
+		stats.QueueLen += len(queue)
+	}
+	stats.QueueCap = cap(p.slots)
+	// 先读completed再读submitted, 入队的任务在入队前已计入submitted, 不会出现Completed超过Submitted
+	stats.Completed = p.completed.Load()
+	stats.Submitted = p.submitted.Load()
+	stats.Rejected = p.rejected.Load()
+	stats.Overrun = p.overrun.Load()
+	stats.QueueWait = p.queueWait.snapshot()
+	stats.Exec = p.exec.snapshot()
+	return stats
+}
+
+// Close 关闭协程池, 之后的提交返回ErrWorkerPoolClosed, 已入队的任务执行完后返回
 func (p *WorkerPool) Close() {
-	if atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
-		close(p.taskQueue)
-		p.wg.Wait()
+	// 持有p.mu设置关闭标记, 保证之后不会再启动新协程
+	p.mu.Lock()
+	closing := atomic.CompareAndSwapInt32(&p.closed, 0, 1)
+	p.mu.Unlock()
+	if !closing {
+		return
+	}
+
+	// 唤醒等待队列空间的提交方, 待所有提交方离开后再关闭队列
+	close(p.quit)
+	p.sendMu.Lock()
+	for _, queue := range p.queues {
+		close(queue)
 	}
+	p.sendMu.Unlock()
+	p.wg.Wait()
 }
@@ -0,0 +1,348 @@
+package snet
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolQueueSizeIsTotal(t *testing.T) {
+	pool := newWorkerPool(1, 9)
+	release := make(chan struct{})
+	defer pool.Close()
+	defer close(release)
+	pool.TrySubmit(func() { <-release })
+	waitFor(t, "worker to block", func() bool { return pool.Stats().Busy == 1 })
+
+	// 普通优先级的任务可以占满全部容量
+	for i := range 9 {
+		if err := pool.TrySubmit(func() {}); err != nil {
+			t.Fatalf("TrySubmit %d: %v", i, err)
+		}
+	}
+	if err := pool.TrySubmit(func() {}); !errors.Is(err, ErrWorkerPoolQueueFull) {
+		t.Fatalf("TrySubmit over capacity = %v, want ErrWorkerPoolQueueFull", err)
+	}
+	// 各优先级共享总容量
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.SubmitPriority(ctx, TaskPriorityHigh, func() {}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("high priority submit over capacity = %v", err)
+	}
+	if s := pool.Stats(); s.QueueLen != 9 || s.QueueCap != 9 {
+		t.Fatalf("QueueLen %d QueueCap %d, want 9", s.QueueLen, s.QueueCap)
+	}
+}
+
+func TestPoolGrowsWithoutQueue(t *testing.T) {
+	pool := NewWorkerPool(PoolConfig{MinWorkers: 1, MaxWorkers: 4})
+	defer pool.Close()
+
+	// 等待常驻协程开始等待任务
+	time.Sleep(10 * time.Millisecond)
+	release := make(chan struct{})
+	defer close(release)
+	for i := range 4 {
+		if err := pool.TrySubmit(func() { <-release }); err != nil {
+			t.Fatalf("task %d: %v", i, err)
+		}
+	}
+	if n := pool.Workers(); n != 4 {
+		t.Fatalf("Workers = %d, want 4", n)
+	}
+	if err := pool.TrySubmit(func() {}); !errors.Is(err, ErrWorkerPoolQueueFull) {
+		t.Fatalf("submit beyond MaxWorkers: %v, want ErrWorkerPoolQueueFull", err)
+	}
+}
+
+func TestPoolShrinksWhenIdle(t *testing.T) {
+	pool := NewWorkerPool(PoolConfig{MinWorkers: 1, MaxWorkers: 4, IdleTimeout: 20 * time.Millisecond})
+	defer pool.Close()
+
+	time.Sleep(10 * time.Millisecond)
+	release := make(chan struct{})
+	for range 4 {
+		if err := pool.TrySubmit(func() { <-release }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := pool.Workers(); n != 4 {
+		t.Fatalf("Workers = %d, want 4", n)
+	}
+	close(release)
+	// 超出常驻数量的协程空闲超时后退出
+	waitFor(t, "idle workers to exit", func() bool { return pool.Workers() == 1 })
+	time.Sleep(50 * time.Millisecond)
+	if n := pool.Workers(); n != 1 {
+		t.Fatalf("Workers = %d after idling, want MinWorkers", n)
+	}
+}
+
+func TestPoolResize(t *testing.T) {
+	pool := NewWorkerPool(PoolConfig{MinWorkers: 1, MaxWorkers: 2, IdleTimeout: 20 * time.Millisecond})
+	defer pool.Close()
+
+	pool.Resize(3, 6)
+	if n := pool.Workers(); n != 3 {
+		t.Fatalf("Workers = %d after raising MinWorkers, want 3", n)
+	}
+	if s := pool.Stats(); s.MinWorkers != 3 || s.MaxWorkers != 6 {
+		t.Fatalf("Stats = %+v", s)
+	}
+	// 缩容在空闲超时后逐步生效
+	pool.Resize(1, 1)
+	waitFor(t, "pool to shrink", func() bool { return pool.Workers() == 1 })
+}
+
+func TestPoolCloseRunsQueuedTasks(t *testing.T) {
+	pool := newWorkerPool(1, 30)
+	release := make(chan struct{})
+	var ran atomic.Int32
+	pool.TrySubmit(func() { <-release })
+	for range 4 {
+		if err := pool.TrySubmit(func() { ran.Add(1) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(closed)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	<-closed
+	if n := ran.Load(); n != 4 {
+		t.Fatalf("%d queued tasks ran before Close returned, want 4", n)
+	}
+	if err := pool.TrySubmit(func() {}); !errors.Is(err, ErrWorkerPoolClosed) {
+		t.Fatalf("submit after Close: %v", err)
+	}
+	if n := pool.Workers(); n != 0 {
+		t.Fatalf("Workers = %d after Close", n)
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	pool := NewWorkerPool(PoolConfig{MinWorkers: 1, QueueSize: 30, TaskTimeout: 10 * time.Millisecond})
+	defer pool.Close()
+	overruns := make(chan TaskOverrun, 1)
+	pool.OnOverrun(func(o TaskOverrun) { overruns <- o })
+
+	release := make(chan struct{})
+	pool.TrySubmit(func() { <-release })
+	for range 2 {
+		pool.TrySubmit(func() {})
+	}
+	waitFor(t, "first task to start", func() bool { return pool.Stats().Busy == 1 })
+	s := pool.Stats()
+	if s.Workers != 1 || s.Idle != 0 || s.QueueLen != 2 || s.Queued[TaskPriorityNormal] != 2 || s.QueueCap != 30 {
+		t.Fatalf("Stats while busy = %+v", s)
+	}
+
+	// 执行超时的任务被报告, 但不会被中断
+	select {
+	case o := <-overruns:
+		if o.Timeout != 10*time.Millisecond || o.Started.IsZero() {
+			t.Fatalf("overrun %+v", o)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("overrun not reported")
+	}
+	close(release)
+
+	waitFor(t, "tasks to complete", func() bool { return pool.Stats().Completed == 3 })
+	s = pool.Stats()
+	if s.Submitted != 3 || s.Busy != 0 || s.QueueLen != 0 || s.Overrun != 1 {
+		t.Fatalf("Stats after completion = %+v", s)
+	}
+	if s.Exec.Count != 3 || s.QueueWait.Count != 3 {
+		t.Fatalf("histograms: exec %d, queue wait %d samples", s.Exec.Count, s.QueueWait.Count)
+	}
+
+	pool.Close()
+	pool.TrySubmit(func() {})
+	if s := pool.Stats(); s.Rejected != 1 || s.Submitted != 3 {
+		t.Fatalf("Stats after rejected submit = %+v", s)
+	}
+}
+
+// blockedPool 唯一的协程被阻塞且normal队列已满的协程池, release放行所有任务
+func blockedPool(t *testing.T) (pool *WorkerPool, release chan struct{}) {
+	t.Helper()
+	pool = newWorkerPool(1, 3)
+	release = make(chan struct{})
+	t.Cleanup(pool.Close)
+	pool.TrySubmit(func() { <-release })
+	waitFor(t, "worker to block", func() bool { return pool.Stats().Busy == 1 })
+	for pool.TrySubmit(func() {}) == nil {
+	}
+	return pool, release
+}
+
+func TestSubmitContextWaitsForSpace(t *testing.T) {
+	pool, release := blockedPool(t)
+
+	done := make(chan error, 1)
+	go func() { done <- pool.SubmitContext(context.Background(), func() {}) }()
+	select {
+	case err := <-done:
+		t.Fatalf("SubmitContext returned %v while the queue was full", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubmitContextDeadline(t *testing.T) {
+	pool, release := blockedPool(t)
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := pool.SubmitContext(ctx, func() {}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("SubmitContext = %v, want DeadlineExceeded", err)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Fatal("SubmitContext returned before the deadline")
+	}
+	if err := pool.TrySubmit(func() {}); !errors.Is(err, ErrWorkerPoolQueueFull) {
+		t.Fatalf("TrySubmit = %v, want ErrWorkerPoolQueueFull", err)
+	}
+}
+
+func TestSubmitContextCountsOnlyAccepted(t *testing.T) {
+	pool, release := blockedPool(t)
+	defer close(release)
+	before := pool.Stats()
+
+	// 等待中和超时被拒绝的提交都不计入Submitted, 计数只增不减
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- pool.SubmitContext(ctx, func() {}) }()
+	time.Sleep(10 * time.Millisecond)
+	if s := pool.Stats(); s.Submitted != before.Submitted {
+		t.Fatalf("Submitted %d while waiting, want %d", s.Submitted, before.Submitted)
+	}
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("SubmitContext = %v, want DeadlineExceeded", err)
+	}
+	if s := pool.Stats(); s.Submitted != before.Submitted || s.Rejected != before.Rejected+1 {
+		t.Fatalf("after timeout: Submitted %d Rejected %d, before %+v", s.Submitted, s.Rejected, before)
+	}
+}
+
+func TestSubmitContextWokenByClose(t *testing.T) {
+	pool, release := blockedPool(t)
+
+	done := make(chan error, 1)
+	go func() { done <- pool.SubmitContext(context.Background(), func() {}) }()
+	time.Sleep(10 * time.Millisecond)
+	go pool.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrWorkerPoolClosed) {
+			t.Fatalf("SubmitContext = %v, want ErrWorkerPoolClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting submit not woken by Close")
+	}
+	close(release)
+}
+
+// orderedRun 返回记录执行顺序的任务及读取顺序的函数
+func orderedRun() (run func(name string) func(), order func() []string) {
+	var mu sync.Mutex
+	var names []string
+	run = func(name string) func() {
+		return func() {
+			mu.Lock()
+			names = append(names, name)
+			mu.Unlock()
+		}
+	}
+	order = func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(names)
+	}
+	return run, order
+}
+
+func TestPoolPriorityOrder(t *testing.T) {
+	pool := newWorkerPool(1, 30)
+	release := make(chan struct{})
+	pool.TrySubmit(func() { <-release })
+	waitFor(t, "worker to block", func() bool { return pool.Stats().Busy == 1 })
+
+	run, order := orderedRun()
+	ctx := context.Background()
+	for _, task := range []struct {
+		name     string
+		priority TaskPriority
+	}{{"low", TaskPriorityLow}, {"normal", TaskPriorityNormal}, {"high", TaskPriorityHigh}} {
+		if err := pool.SubmitPriority(ctx, task.priority, run(task.name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(release)
+	pool.Close()
+
+	if got, want := order(), []string{"high", "normal", "low"}; !slices.Equal(got, want) {
+		t.Fatalf("order %v, want %v", got, want)
+	}
+}
+
+func TestPoolLowPriorityNotStarved(t *testing.T) {
+	pool := newWorkerPool(1, 60)
+	release := make(chan struct{})
+	pool.TrySubmit(func() { <-release })
+	waitFor(t, "worker to block", func() bool { return pool.Stats().Busy == 1 })
+
+	run, order := orderedRun()
+	ctx := context.Background()
+	if err := pool.SubmitPriority(ctx, TaskPriorityLow, run("low")); err != nil {
+		t.Fatal(err)
+	}
+	for range 20 {
+		if err := pool.SubmitPriority(ctx, TaskPriorityHigh, run("high")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(release)
+	pool.Close()
+
+	// 低优先级任务被越过starvationLimit次后先于剩余的高优先级任务执行
+	got := order()
+	if i := slices.Index(got, "low"); i != starvationLimit {
+		t.Fatalf("low priority task ran at %d, want %d: %v", i, starvationLimit, got)
+	}
+}
+
+func TestHandlerTaskPriority(t *testing.T) {
+	s := NewServer("")
+	noop := func(conn *Conn, packet *Packet) {}
+	s.AddHandlerFunc(PacketTypeLogin, noop)
+	s.AddHandlerFunc(PacketTypeChat, noop, WithTaskPriority(TaskPriorityLow))
+	s.AddHandlerFunc(PacketTypeLogout, noop, WithTaskPriority(TaskPriorityNormal))
+
+	for packetType, want := range map[PacketType]TaskPriority{
+		PacketTypeLogin:  TaskPriorityHigh,
+		PacketTypeAuth:   TaskPriorityHigh,
+		PacketTypeChat:   TaskPriorityLow,
+		PacketTypeLogout: TaskPriorityNormal,
+	} {
+		if got := s.taskPriorities[packetType]; got != want {
+			t.Errorf("priority of type %d = %d, want %d", packetType, got, want)
+		}
+	}
+}
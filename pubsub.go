@@ -0,0 +1,286 @@
+package snet
+
+import (
+	"context"
+	"encoding/binary"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 主题以'.'分隔层级, 订阅时'*'匹配一个层级, '#'匹配之后的任意层级(只能位于末尾)
+const (
+	topicSeparator      = "."
+	topicWildcardOne    = "*"
+	topicWildcardRemain = "#"
+)
+
+// validTopic 检查主题或订阅模式是否合法
+func validTopic(topic string, pattern bool) bool {
+	if topic == "" || len(topic) > 0xFFFF {
+		return false
+	}
+	segments := strings.Split(topic, topicSeparator)
+	for i, seg := range segments {
+		switch {
+		case seg == "":
+			return false
+		case seg == topicWildcardOne:
+			if !pattern {
+				return false
+			}
+		case seg == topicWildcardRemain:
+			if !pattern || i != len(segments)-1 {
+				return false
+			}
+		case strings.ContainsAny(seg, topicWildcardOne+topicWildcardRemain):
+			return false
+		}
+	}
+	return true
+}
+
+// matchTopic 判断主题是否匹配订阅模式
+func matchTopic(pattern, topic []string) bool {
+	for i, seg := range pattern {
+		if seg == topicWildcardRemain {
+			return true
+		}
+		if i >= len(topic) || (seg != topicWildcardOne && seg != topic[i]) {
+			return false
+		}
+	}
+	return len(pattern) == len(topic)
+}
+
+// encodePublish 发布包数据: 2字节主题长度 + 主题 + 消息
+func encodePublish(topic string, payload []byte) []byte {
+	data := make([]byte, 2+len(topic)+len(payload))
+	binary.BigEndian.PutUint16(data, uint16(len(topic)))
+	copy(data[2:], topic)
+	copy(data[2+len(topic):], payload)
+	return data
+}
+
+// ParsePublish 解析PacketTypePublish数据包中的主题和消息
+func ParsePublish(packet *Packet) (topic string, payload []byte, err error) {
+	data := packet.Data
+	if len(data) < 2 {
+		return "", nil, ErrTopicInvalid
+	}
+	n := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+n {
+		return "", nil, ErrTopicInvalid
+	}
+	return string(data[2 : 2+n]), data[2+n:], nil
+}
+
+// subscriber 订阅者, 每个连接一个, 拥有独立的有界投递队列
+type subscriber struct {
+	conn     *Conn
+	patterns map[string][]string // 订阅模式 -> 按层级拆分
+	queue    chan []byte         // 已编码的发布包
+	done     chan struct{}
+}
+
+// run 将队列中的消息依次写到连接
+func (sub *subscriber) run() {
+	priority := sub.conn.priorities.ofType(PacketTypePublish)
+	for {
+		select {
+		case data := <-sub.queue:
+			if err := sub.conn.write(priority, data); err != nil {
+				return
+			}
+		case <-sub.done:
+			return
+		case <-sub.conn.closed:
+			return
+		}
+	}
+}
+
+// PubSub 基于主题的发布订阅
+type PubSub struct {
+	mu        sync.RWMutex
+	subs      map[uint64]*subscriber
+	queueSize int
+	dropped   atomic.Uint64
+}
+
+// NewPubSub 创建发布订阅, queueSize为每个订阅者的队列容量, 队列满时丢弃最旧的消息
+func NewPubSub(cm *ConnManager, queueSize int) *PubSub {
+	if queueSize <= 0 {
+		queueSize = 256
+	}
+	ps := &PubSub{
+		subs:      make(map[uint64]*subscriber),
+		queueSize: queueSize,
+	}
+	cm.OnRemove(ps.UnsubscribeAll)
+	return ps
+}
+
+// Subscribe 为连接订阅主题模式, 连接已关闭时返回ErrConnClosed
+func (ps *PubSub) Subscribe(conn *Conn, pattern string) error {
+	if !validTopic(pattern, true) {
+		return ErrTopicInvalid
+	}
+	ps.subscribe(conn, pattern)
+
+	// 连接关闭后ConnManager移除连接时会取消其所有订阅,
+	// 订阅晚于移除回调时由这里撤销, 否则订阅者将一直留在表中
+	if conn.isClosed() {
+		ps.UnsubscribeAll(conn)
+		return ErrConnClosed
+	}
+	return nil
+}
+
+// subscribe 登记订阅
+func (ps *PubSub) subscribe(conn *Conn, pattern string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	sub := ps.subs[conn.id]
+	if sub == nil {
+		sub = &subscriber{
+			conn:     conn,
+			patterns: make(map[string][]string),
+			queue:    make(chan []byte, ps.queueSize),
+			done:     make(chan struct{}),
+		}
+		ps.subs[conn.id] = sub
+		go sub.run()
+	}
+	sub.patterns[pattern] = strings.Split(pattern, topicSeparator)
+}
+
+// Unsubscribe 取消连接对主题模式的订阅
+func (ps *PubSub) Unsubscribe(conn *Conn, pattern string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	sub := ps.subs[conn.id]
+	if sub == nil {
+		return
+	}
+	delete(sub.patterns, pattern)
+	if len(sub.patterns) == 0 {
+		delete(ps.subs, conn.id)
+		close(sub.done)
+	}
+}
+
+// UnsubscribeAll 取消连接的所有订阅
+func (ps *PubSub) UnsubscribeAll(conn *Conn) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if sub := ps.subs[conn.id]; sub != nil {
+		delete(ps.subs, conn.id)
+		close(sub.done)
+	}
+}
+
+// Publish 向匹配主题的订阅者发布消息, 返回投递的订阅者数量
+func (ps *PubSub) Publish(topic string, payload []byte) (int, error) {
+	if !validTopic(topic, false) {
+		return 0, ErrTopicInvalid
+	}
+	data, err := (&defaultEncoder{}).encode(NewPacket(PacketTypePublish, encodePublish(topic, payload), 0))
+	if err != nil {
+		return 0, err
+	}
+	segments := strings.Split(topic, topicSeparator)
+
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	delivered := 0
+	for _, sub := range ps.subs {
+		for _, pattern := range sub.patterns {
+			if matchTopic(pattern, segments) {
+				ps.enqueue(sub, data)
+				delivered++
+				break
+			}
+		}
+	}
+	return delivered, nil
+}
+
+// enqueue 放入订阅者队列, 队列满时丢弃最旧的消息
+func (ps *PubSub) enqueue(sub *subscriber, data []byte) {
+	for {
+		select {
+		case sub.queue <- data:
+			return
+		default:
+		}
+		select {
+		case <-sub.queue:
+			ps.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+// Dropped 因订阅者队列已满丢弃的消息数量
+func (ps *PubSub) Dropped() uint64 {
+	return ps.dropped.Load()
+}
+
+// Handle 处理客户端的订阅、取消订阅和发布请求
+func (ps *PubSub) Handle(conn *Conn, packet *Packet) {
+	var err error
+	switch packet.Header.Type {
+	case PacketTypeSubscribe:
+		err = ps.Subscribe(conn, string(packet.Data))
+	case PacketTypeUnsubscribe:
+		ps.Unsubscribe(conn, string(packet.Data))
+	case PacketTypePublish:
+		var topic string
+		var payload []byte
+		if topic, payload, err = ParsePublish(packet); err == nil {
+			_, err = ps.Publish(topic, payload)
+		}
+	}
+
+	if err != nil {
+		conn.SendPacket(NewPacket(PacketTypeError, []byte(err.Error()), packet.Header.Seq))
+		return
+	}
+	conn.SendPacket(NewPacket(PacketTypeAck, nil, packet.Header.Seq))
+}
+
+// PubSub 服务器的发布订阅, 首次调用时注册订阅相关包类型的handler
+func (s *Server) PubSub() *PubSub {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pubsub == nil {
+		s.pubsub = NewPubSub(s.connManager, 0)
+		s.handlers[PacketTypeSubscribe] = s.pubsub
+		s.handlers[PacketTypeUnsubscribe] = s.pubsub
+		s.handlers[PacketTypePublish] = s.pubsub
+	}
+	return s.pubsub
+}
+
+// Subscribe 订阅主题模式, 发布的消息以PacketTypePublish数据包到达, 可用ParsePublish解析
+func (c *Client) Subscribe(ctx context.Context, pattern string) error {
+	return c.requestAck(ctx, PacketTypeSubscribe, []byte(pattern))
+}
+
+// Unsubscribe 取消订阅
+func (c *Client) Unsubscribe(ctx context.Context, pattern string) error {
+	return c.requestAck(ctx, PacketTypeUnsubscribe, []byte(pattern))
+}
+
+// Publish 发布消息
+func (c *Client) Publish(ctx context.Context, topic string, payload []byte) error {
+	if !validTopic(topic, false) {
+		return ErrTopicInvalid
+	}
+	return c.requestAck(ctx, PacketTypePublish, encodePublish(topic, payload))
+}
@@ -0,0 +1,150 @@
+package snet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// pipeConn 基于net.Pipe的连接, 测试结束时关闭
+func pipeConn(t *testing.T) *Conn {
+	t.Helper()
+	local, remote := net.Pipe()
+	t.Cleanup(func() {
+		local.Close()
+		remote.Close()
+	})
+	return newConn(local)
+}
+
+func TestSubscribeAfterRemove(t *testing.T) {
+	cm := NewConnManager()
+	ps := NewPubSub(cm, 0)
+	conn := pipeConn(t)
+	cm.Add(conn)
+
+	// 与连接关闭竞争的订阅请求在移除回调之后才执行
+	conn.Close()
+	cm.Remove(conn)
+	if err := ps.Subscribe(conn, "room.*"); !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("Subscribe on closed conn: %v, want ErrConnClosed", err)
+	}
+	ps.mu.RLock()
+	n := len(ps.subs)
+	ps.mu.RUnlock()
+	if n != 0 {
+		t.Fatalf("%d subscribers left after remove", n)
+	}
+}
+
+func TestTopicMatching(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, topic string
+		match          bool
+	}{
+		{"news.sports", "news.sports", true},
+		{"news.*", "news.sports", true},
+		{"news.*", "news.sports.nba", false},
+		{"news.#", "news.sports.nba", true},
+		{"news.#", "news", true},
+		{"*.sports", "news.sports", true},
+		{"news.sports", "news", false},
+	} {
+		got := matchTopic(strings.Split(tc.pattern, "."), strings.Split(tc.topic, "."))
+		if got != tc.match {
+			t.Errorf("matchTopic(%q, %q) = %v", tc.pattern, tc.topic, got)
+		}
+	}
+
+	for topic, valid := range map[string]bool{
+		"news":     true,
+		"news.*":   false,
+		"news..a":  false,
+		"":         false,
+		"news.a#b": false,
+	} {
+		if validTopic(topic, false) != valid {
+			t.Errorf("validTopic(%q) != %v", topic, valid)
+		}
+	}
+	for pattern, valid := range map[string]bool{
+		"news.*":   true,
+		"#":        true,
+		"news.#.a": false,
+		"news.s*":  false,
+	} {
+		if validTopic(pattern, true) != valid {
+			t.Errorf("validTopic(%q, pattern) != %v", pattern, valid)
+		}
+	}
+}
+
+func TestPubSubEndToEnd(t *testing.T) {
+	s := NewServer("")
+	s.PubSub()
+	addr := startServer(t, s)
+	sub, pub := dialClient(t, addr), dialClient(t, addr)
+	ctx := context.Background()
+
+	if err := sub.Subscribe(ctx, "news.*"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Subscribe(ctx, "news..bad"); err == nil || err.Error() != ErrTopicInvalid.Error() {
+		t.Fatalf("invalid pattern: %v", err)
+	}
+	if err := pub.Publish(ctx, "weather.today", []byte("rain")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.Publish(ctx, "news.sports", []byte("goal")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 不匹配的主题不会投递, 第一条收到的就是news.sports
+	packet, err := sub.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, payload, err := ParsePublish(packet)
+	if err != nil || topic != "news.sports" || string(payload) != "goal" {
+		t.Fatalf("got %q %q %v", topic, payload, err)
+	}
+
+	if err := sub.Unsubscribe(ctx, "news.*"); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.PubSub().Publish("news.sports", nil); n != 0 {
+		t.Fatalf("delivered to %d subscribers after Unsubscribe", n)
+	}
+}
+
+func TestPubSubDropsOldest(t *testing.T) {
+	cm := NewConnManager()
+	ps := NewPubSub(cm, 1)
+	rc := &recordConn{gate: make(chan struct{})}
+	conn := newConn(rc)
+	cm.Add(conn)
+	if err := ps.Subscribe(conn, "#"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 第一条阻塞在写出上, 之后队列只保留最新的一条
+	ps.Publish("a", []byte{1})
+	waitFor(t, "writer to block", func() bool { return rc.pending.Load() == 1 })
+	for i := range 3 {
+		if n, err := ps.Publish("a", []byte{byte(2 + i)}); n != 1 || err != nil {
+			t.Fatalf("Publish = %d, %v", n, err)
+		}
+	}
+	if n := ps.Dropped(); n != 2 {
+		t.Fatalf("dropped %d, want 2", n)
+	}
+	close(rc.gate)
+	waitFor(t, "queue delivered", func() bool { n, _ := rc.written(); return n == 2 })
+
+	cm.Remove(conn)
+	if n, _ := ps.Publish("a", nil); n != 0 {
+		t.Fatalf("delivered to %d subscribers after Remove", n)
+	}
+}
@@ -0,0 +1,266 @@
+package snet
+
+import (
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// RateLimit 令牌桶限流参数
+type RateLimit struct {
+	Rate  float64 // 每秒补充的令牌数, 即允许的平均包速率, 0表示不限流
+	Burst int     // 桶容量, 即允许的突发包数, 默认为Rate向上取整
+}
+
+// LimitAction 超出限流时的处理方式
+type LimitAction uint8
+
+const (
+	LimitDelay      LimitAction = iota // 等待令牌后再处理, 期间暂停读取该连接
+	LimitReject                        // 丢弃数据包并回复PacketTypeError
+	LimitDisconnect                    // 断开连接
+)
+
+// RateLimitConfig 限流配置
+type RateLimitConfig struct {
+	PerConn       RateLimit                // 每个连接的包速率
+	PerIP         RateLimit                // 同一远端IP所有连接共享的包速率
+	PerType       map[PacketType]RateLimit // 每个连接上各包类型的包速率
+	Action        LimitAction              // 超出限流时的处理方式
+	MaxConns      int                      // 全局最大连接数, 0表示不限制
+	MaxConnsPerIP int                      // 每个远端IP的最大连接数, 0表示不限制
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = math.Ceil(limit.Rate)
+	}
+	return &tokenBucket{
+		rate:   limit.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// refill 按时间补充令牌, 调用方需持有b.mu
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// allow 有令牌时取走一个并返回true
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// reserve 预支一个令牌, 返回需要等待的时长
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// full 令牌是否已补满
+func (b *tokenBucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// ipEntry 同一远端IP的连接数和共享令牌桶
+type ipEntry struct {
+	conns  int
+	bucket *tokenBucket
+}
+
+// rateLimiter 服务端限流器
+type rateLimiter struct {
+	cfg     RateLimitConfig
+	mu      sync.Mutex
+	conns   int
+	ips     map[string]*ipEntry
+	accepts int
+}
+
+func newRateLimiter(cfg RateLimitConfig) *rateLimiter {
+	return &rateLimiter{
+		cfg: cfg,
+		ips: make(map[string]*ipEntry),
+	}
+}
+
+// remoteIP 连接的远端IP
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// admit 检查连接数限制, 通过时计入连接数, 连接结束后需调用release
+func (l *rateLimiter) admit(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cfg.MaxConns > 0 && l.conns >= l.cfg.MaxConns {
+		return false
+	}
+	entry := l.ips[ip]
+	if entry != nil && l.cfg.MaxConnsPerIP > 0 && entry.conns >= l.cfg.MaxConnsPerIP {
+		return false
+	}
+
+	if entry == nil {
+		entry = &ipEntry{bucket: newTokenBucket(l.cfg.PerIP)}
+		l.ips[ip] = entry
+	}
+	entry.conns++
+	l.conns++
+
+	// 定期清理没有连接且令牌已补满的IP, 令牌未满的保留以免断开重连绕过限流
+	l.accepts++
+	if l.accepts%1024 == 0 {
+		now := time.Now()
+		for key, e := range l.ips {
+			if e.conns == 0 && (e.bucket == nil || e.bucket.full(now)) {
+				delete(l.ips, key)
+			}
+		}
+	}
+	return true
+}
+
+// release 连接结束
+func (l *rateLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.conns--
+	if entry := l.ips[ip]; entry != nil {
+		entry.conns--
+		if entry.conns == 0 && (entry.bucket == nil || entry.bucket.full(time.Now())) {
+			delete(l.ips, ip)
+		}
+	}
+}
+
+// ipBucket 远端IP共享的令牌桶
+func (l *rateLimiter) ipBucket(ip string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if entry := l.ips[ip]; entry != nil {
+		return entry.bucket
+	}
+	return nil
+}
+
+// connLimiter 单个连接的限流状态, 只在连接的读循环中使用
+type connLimiter struct {
+	action LimitAction
+	conn   *tokenBucket
+	ip     *tokenBucket
+	types  map[PacketType]*tokenBucket
+}
+
+// forConn 创建连接的限流状态
+func (l *rateLimiter) forConn(ip string) *connLimiter {
+	cl := &connLimiter{
+		action: l.cfg.Action,
+		conn:   newTokenBucket(l.cfg.PerConn),
+		ip:     l.ipBucket(ip),
+	}
+	if len(l.cfg.PerType) > 0 {
+		cl.types = make(map[PacketType]*tokenBucket, len(l.cfg.PerType))
+		for packetType, limit := range l.cfg.PerType {
+			if bucket := newTokenBucket(limit); bucket != nil {
+				cl.types[packetType] = bucket
+			}
+		}
+	}
+	return cl
+}
+
+// wait 按LimitDelay为数据包预支令牌, 返回需要等待的时长
+func (cl *connLimiter) wait(packetType PacketType) time.Duration {
+	now := time.Now()
+	var delay time.Duration
+	for _, bucket := range []*tokenBucket{cl.conn, cl.ip, cl.types[packetType]} {
+		if bucket != nil {
+			delay = max(delay, bucket.reserve(now))
+		}
+	}
+	return delay
+}
+
+// allow 不等待地检查数据包是否在限流范围内
+func (cl *connLimiter) allow(packetType PacketType) bool {
+	now := time.Now()
+	for _, bucket := range []*tokenBucket{cl.types[packetType], cl.conn, cl.ip} {
+		if bucket != nil && !bucket.allow(now) {
+			return false
+		}
+	}
+	return true
+}
+
+// throttle 按限流处理数据包, 返回false表示数据包被丢弃或连接应断开
+func (s *Server) throttle(conn *Conn, packet *Packet, cl *connLimiter) bool {
+	switch cl.action {
+	case LimitDelay:
+		if delay := cl.wait(packet.Header.Type); delay > 0 {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-conn.closed:
+				return false
+			}
+		}
+		return true
+	case LimitReject:
+		if cl.allow(packet.Header.Type) {
+			return true
+		}
+		s.reject(conn, packet, ErrRateLimited)
+		return false
+	default:
+		return cl.allow(packet.Header.Type)
+	}
+}
+
+// SetRateLimit 设置限流: 连接数限制在接受连接时检查, 包速率限制在读取数据包后检查.
+// 流的数据帧不计入包速率, 其速率由流控窗口约束
+func (s *Server) SetRateLimit(cfg RateLimitConfig) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limiter = newRateLimiter(cfg)
+	return s
+}
@@ -0,0 +1,82 @@
+package snet
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// connCount 限流器当前计入的连接数
+func (l *rateLimiter) connCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.conns
+}
+
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(RateLimit{Rate: 10, Burst: 2})
+	now := time.Now()
+	if !bucket.allow(now) || !bucket.allow(now) {
+		t.Fatal("burst not allowed")
+	}
+	if bucket.allow(now) {
+		t.Fatal("allowed beyond burst")
+	}
+	if !bucket.allow(now.Add(100 * time.Millisecond)) {
+		t.Fatal("token not refilled after 1/rate")
+	}
+	if d := bucket.reserve(now.Add(100 * time.Millisecond)); d < 90*time.Millisecond || d > 110*time.Millisecond {
+		t.Fatalf("reserve on empty bucket waits %v, want about 100ms", d)
+	}
+	if newTokenBucket(RateLimit{}) != nil {
+		t.Fatal("zero rate should disable the bucket")
+	}
+}
+
+func TestConnLimitReleasedOnHandshakeFailure(t *testing.T) {
+	server, client := certManagers(t, "127.0.0.1")
+	useCertManagers(t, server, client)
+	s := NewServer("").SetRateLimit(RateLimitConfig{MaxConns: 1})
+	s.AddHandlerFunc(PacketTypeChat, func(conn *Conn, packet *Packet) {})
+	addr := startServer(t, s)
+
+	// 非TLS客户端导致握手失败
+	raw, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	raw.Write([]byte("not a tls client hello"))
+	// 服务端握手失败后关闭连接
+	io.Copy(io.Discard, raw)
+	waitFor(t, "handshake failure to release the slot", func() bool {
+		return s.limiter.connCount() == 0
+	})
+
+	dialClient(t, addr)
+	if n := s.limiter.connCount(); n != 1 {
+		t.Fatalf("limiter counts %d connections, want 1", n)
+	}
+}
+
+func TestRateLimitReject(t *testing.T) {
+	s := NewServer("").SetRateLimit(RateLimitConfig{
+		PerType: map[PacketType]RateLimit{PacketTypeCommand: {Rate: 0.01, Burst: 2}},
+		Action:  LimitReject,
+	})
+	s.AddHandlerFunc(PacketTypeCommand, func(conn *Conn, packet *Packet) {
+		conn.SendPacket(NewPacket(PacketTypeAck, nil, packet.Header.Seq))
+	})
+	c := dialClient(t, startServer(t, s))
+
+	for i, want := range []PacketType{PacketTypeAck, PacketTypeAck, PacketTypeError} {
+		packet, err := c.Request(t.Context(), PacketTypeCommand, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packet.Header.Type != want {
+			t.Fatalf("request %d: got type %d, want %d", i, packet.Header.Type, want)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package snet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// rpcRequest RPC请求体
+type rpcRequest struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse RPC响应体
+type rpcResponse struct {
+	Error  string          `json:"error,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+}
+
+// RPCError 服务端方法返回的错误
+type RPCError string
+
+func (e RPCError) Error() string {
+	return string(e)
+}
+
+type connContextKey struct{}
+
+// ConnFromContext 从RPC方法的ctx中取出调用方连接
+func ConnFromContext(ctx context.Context) (*Conn, bool) {
+	conn, ok := ctx.Value(connContextKey{}).(*Conn)
+	return conn, ok
+}
+
+var (
+	typeOfError   = reflect.TypeFor[error]()
+	typeOfContext = reflect.TypeFor[context.Context]()
+)
+
+// rpcMethod 已注册的方法
+type rpcMethod struct {
+	method    reflect.Method
+	argType   reflect.Type
+	replyType reflect.Type
+}
+
+// rpcService 已注册的服务
+type rpcService struct {
+	name    string
+	rcvr    reflect.Value
+	methods map[string]*rpcMethod
+}
+
+// rpcServer 服务注册表, 作为PacketTypeRPCRequest的handler
+type rpcServer struct {
+	mu       sync.RWMutex
+	services map[string]*rpcService
+}
+
+func newRPCServer() *rpcServer {
+	return &rpcServer{
+		services: make(map[string]*rpcService),
+	}
+}
+
+// register 注册服务, 导出方法需满足 func (s *T) Method(ctx context.Context, args *Args, reply *Reply) error
+func (r *rpcServer) register(name string, rcvr any) error {
+	typ := reflect.TypeOf(rcvr)
+	if typ == nil {
+		return fmt.Errorf("%w: nil receiver", ErrRPCServiceInvalid)
+	}
+	svc := &rpcService{
+		rcvr:    reflect.ValueOf(rcvr),
+		methods: make(map[string]*rpcMethod),
+	}
+	if name == "" {
+		name = reflect.Indirect(svc.rcvr).Type().Name()
+	}
+	if !token.IsExported(name) {
+		return fmt.Errorf("%w: %q is not exported", ErrRPCServiceInvalid, name)
+	}
+	svc.name = name
+
+	for i := 0; i < typ.NumMethod(); i++ {
+		if m := suitableMethod(typ.Method(i)); m != nil {
+			svc.methods[m.method.Name] = m
+		}
+	}
+	if len(svc.methods) == 0 {
+		return fmt.Errorf("%w: %s has no suitable methods", ErrRPCServiceInvalid, name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.services[name]; exists {
+		return fmt.Errorf("%w: %s", ErrRPCServiceRegistered, name)
+	}
+	r.services[name] = svc
+	return nil
+}
+
+// suitableMethod 检查方法签名是否符合RPC约定
+func suitableMethod(method reflect.Method) *rpcMethod {
+	mtype := method.Type
+	if !method.IsExported() || mtype.NumIn() != 4 || mtype.NumOut() != 1 {
+		return nil
+	}
+	if mtype.In(1) != typeOfContext {
+		return nil
+	}
+	argType, replyType := mtype.In(2), mtype.In(3)
+	if replyType.Kind() != reflect.Pointer {
+		return nil
+	}
+	if mtype.Out(0) != typeOfError {
+		return nil
+	}
+	return &rpcMethod{
+		method:    method,
+		argType:   argType,
+		replyType: replyType,
+	}
+}
+
+// lookup 按 "Service.Method" 查找方法
+func (r *rpcServer) lookup(name string) (*rpcService, *rpcMethod, error) {
+	dot := strings.LastIndex(name, ".")
+	if dot < 0 {
+		return nil, nil, fmt.Errorf("%w: %q", ErrRPCBadRequest, name)
+	}
+
+	r.mu.RLock()
+	svc := r.services[name[:dot]]
+	r.mu.RUnlock()
+	if svc == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrRPCServiceNotFound, name[:dot])
+	}
+	m := svc.methods[name[dot+1:]]
+	if m == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrRPCMethodNotFound, name)
+	}
+	return svc, m, nil
+}
+
+// Handle 处理RPC请求并以相同序列号回复
+func (r *rpcServer) Handle(conn *Conn, packet *Packet) {
+	result, err := r.call(conn, packet.Data)
+
+	var resp rpcResponse
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Result = result
+	}
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		data, _ = json.Marshal(&rpcResponse{Error: err.Error()})
+	}
+	conn.SendPacket(NewPacket(PacketTypeRPCResponse, data, packet.Header.Seq))
+}
+
+// call 解析请求并调用对应方法
+func (r *rpcServer) call(conn *Conn, data []byte) (json.RawMessage, error) {
+	var req rpcRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRPCBadRequest, err)
+	}
+	svc, m, err := r.lookup(req.Method)
+	if err != nil {
+		return nil, err
+	}
+
+	// 参数可以是指针或值类型
+	var argv reflect.Value
+	if m.argType.Kind() == reflect.Pointer {
+		argv = reflect.New(m.argType.Elem())
+	} else {
+		argv = reflect.New(m.argType)
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, argv.Interface()); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrRPCBadRequest, err)
+		}
+	}
+	if m.argType.Kind() != reflect.Pointer {
+		argv = argv.Elem()
+	}
+	replyv := reflect.New(m.replyType.Elem())
+
+	ctx := context.WithValue(context.Background(), connContextKey{}, conn)
+	out := m.method.Func.Call([]reflect.Value{svc.rcvr, reflect.ValueOf(ctx), argv, replyv})
+	if errInter := out[0].Interface(); errInter != nil {
+		return nil, errInter.(error)
+	}
+	return json.Marshal(replyv.Interface())
+}
+
+// Register 注册RPC服务, 服务名为接收者的类型名
+func (s *Server) Register(rcvr any) error {
+	return s.RegisterName("", rcvr)
+}
+
+// RegisterName 以指定名称注册RPC服务
+func (s *Server) RegisterName(name string, rcvr any) error {
+	s.mu.Lock()
+	if s.rpc == nil {
+		s.rpc = newRPCServer()
+		s.handlers[PacketTypeRPCRequest] = s.rpc
+	}
+	rpc := s.rpc
+	s.mu.Unlock()
+
+	return rpc.register(name, rcvr)
+}
+
+// Invoke 调用服务端方法, method格式为 "Service.Method", reply需为指针
+func (c *Client) Invoke(ctx context.Context, method string, args any, reply any) error {
+	params, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(&rpcRequest{Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+
+	packet, err := c.Request(ctx, PacketTypeRPCRequest, data)
+	if err != nil {
+		return err
+	}
+
+	var resp rpcResponse
+	if err := json.Unmarshal(packet.Data, &resp); err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return RPCError(resp.Error)
+	}
+	if reply == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, reply)
+}
@@ -0,0 +1,116 @@
+package snet
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type Calculator struct{}
+
+type CalcArgs struct {
+	A, B int
+}
+
+func (Calculator) Add(ctx context.Context, args CalcArgs, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+func (Calculator) Div(ctx context.Context, args *CalcArgs, reply *int) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+func (Calculator) ConnID(ctx context.Context, _ struct{}, reply *uint64) error {
+	conn, ok := ConnFromContext(ctx)
+	if !ok {
+		return errors.New("no conn")
+	}
+	*reply = conn.ID()
+	return nil
+}
+
+func TestRPCInvoke(t *testing.T) {
+	s := NewServer("")
+	if err := s.Register(Calculator{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterName("Calculator", Calculator{}); !errors.Is(err, ErrRPCServiceRegistered) {
+		t.Fatalf("duplicate register: %v", err)
+	}
+	connected := make(chan *Conn, 1)
+	s.OnConnect(func(conn *Conn) { connected <- conn })
+	c := dialClient(t, startServer(t, s))
+	ctx := context.Background()
+
+	var sum int
+	if err := c.Invoke(ctx, "Calculator.Add", CalcArgs{A: 2, B: 3}, &sum); err != nil || sum != 5 {
+		t.Fatalf("Add = %d, %v", sum, err)
+	}
+	var quo int
+	if err := c.Invoke(ctx, "Calculator.Div", CalcArgs{A: 7, B: 2}, &quo); err != nil || quo != 3 {
+		t.Fatalf("Div = %d, %v", quo, err)
+	}
+	var id uint64
+	if err := c.Invoke(ctx, "Calculator.ConnID", struct{}{}, &id); err != nil || id != (<-connected).ID() {
+		t.Fatalf("ConnID = %d, %v", id, err)
+	}
+}
+
+func TestRPCErrors(t *testing.T) {
+	s := NewServer("")
+	if err := s.Register(&Calculator{}); err != nil {
+		t.Fatal(err)
+	}
+	c := dialClient(t, startServer(t, s))
+	ctx := context.Background()
+
+	var reply int
+	err := c.Invoke(ctx, "Calculator.Div", CalcArgs{A: 1}, &reply)
+	var rpcErr RPCError
+	if !errors.As(err, &rpcErr) || rpcErr != "divide by zero" {
+		t.Fatalf("method error: %v", err)
+	}
+	for method, want := range map[string]error{
+		"Calculator.Mul": ErrRPCMethodNotFound,
+		"Math.Add":       ErrRPCServiceNotFound,
+		"Add":            ErrRPCBadRequest,
+	} {
+		err := c.Invoke(ctx, method, CalcArgs{}, &reply)
+		if !errors.As(err, &rpcErr) || !strings.HasPrefix(string(rpcErr), want.Error()) {
+			t.Errorf("%s: got %v, want %v", method, err, want)
+		}
+	}
+	if err := c.Invoke(ctx, "Calculator.Add", "not an object", &reply); !errors.As(err, &rpcErr) || !strings.HasPrefix(string(rpcErr), ErrRPCBadRequest.Error()) {
+		t.Fatalf("bad params: %v", err)
+	}
+}
+
+type unexported struct{}
+
+func (unexported) Add(ctx context.Context, args int, reply *int) error { return nil }
+
+type noMethods struct{}
+
+func (noMethods) Add(args int, reply *int) error { return nil }
+
+func TestRPCRegisterInvalid(t *testing.T) {
+	s := NewServer("")
+	for _, tc := range []struct {
+		name string
+		rcvr any
+	}{
+		{"", nil},
+		{"", unexported{}},
+		{"NoMethods", noMethods{}},
+	} {
+		if err := s.RegisterName(tc.name, tc.rcvr); !errors.Is(err, ErrRPCServiceInvalid) {
+			t.Errorf("RegisterName(%q, %T) = %v, want ErrRPCServiceInvalid", tc.name, tc.rcvr, err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package snet
+
+import (
+	"sync"
+	"time"
+)
+
+// Priority 出站数据包优先级
+type Priority uint8
+
+const (
+	PriorityControl     Priority = iota // 控制类: 心跳、确认、断开等
+	PriorityInteractive                 // 交互类: 未指定优先级的包类型
+	PriorityBulk                        // 批量数据: 文件传输等
+
+	numPriorities = 3
+)
+
+// 低优先级等待者被连续越过该次数后优先写出, 避免饥饿
+const starvationLimit = 16
+
+// priorityTable 包类型到优先级的映射
+type priorityTable struct {
+	mu    sync.RWMutex
+	types map[PacketType]Priority
+}
+
+func newPriorityTable() *priorityTable {
+	return &priorityTable{
+		types: map[PacketType]Priority{
+			PacketTypeHeartbeat:  PriorityControl,
+			PacketTypeAck:        PriorityControl,
+			PacketTypeDisconnect: PriorityControl,
+			PacketTypeFile:       PriorityBulk,
+			PacketTypeFileData:   PriorityBulk,
+		},
+	}
+}
+
+// set 设置包类型的优先级
+func (t *priorityTable) set(packetType PacketType, priority Priority) {
+	if priority >= numPriorities {
+		priority = PriorityBulk
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.types[packetType] = priority
+}
+
+// of 数据包的优先级, 流的窗口更新与重置属于控制类
+func (t *priorityTable) of(packet *Packet) Priority {
+	if packet.Header.Flags&(flagStreamWindow|flagStreamReset) != 0 {
+		return PriorityControl
+	}
+	return t.ofType(packet.Header.Type)
+}
+
+// ofType 包类型的优先级
+func (t *priorityTable) ofType(packetType PacketType) Priority {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if priority, ok := t.types[packetType]; ok {
+		return priority
+	}
+	return PriorityInteractive
+}
+
+// defaultPriorities 未单独配置时使用的优先级
+var defaultPriorities = newPriorityTable()
+
+// writeLock 连接写锁, 高优先级的等待者先获得锁, 同一优先级内按到达顺序,
+// 多个通道的帧因此轮流写出, 大消息不会独占连接
+type writeLock struct {
+	mu      sync.Mutex
+	busy    bool
+	waiters [numPriorities][]chan struct{}
+	skipped [numPriorities]int // 各优先级被越过的次数
+}
+
+// lock 以指定优先级获取写锁
+func (l *writeLock) lock(priority Priority) {
+	l.mu.Lock()
+	if !l.busy {
+		l.busy = true
+		l.mu.Unlock()
+		return
+	}
+	ch := make(chan struct{})
+	l.waiters[priority] = append(l.waiters[priority], ch)
+	l.mu.Unlock()
+	<-ch
+}
+
+// lockTimeout 在timeout内获取写锁, 超时返回false
+func (l *writeLock) lockTimeout(priority Priority, timeout time.Duration) bool {
+	l.mu.Lock()
+	if !l.busy {
+		l.busy = true
+		l.mu.Unlock()
+		return true
+	}
+	ch := make(chan struct{})
+	l.waiters[priority] = append(l.waiters[priority], ch)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ch:
+		return true
+	case <-timer.C:
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, waiter := range l.waiters[priority] {
+		if waiter == ch {
+			l.waiters[priority] = append(l.waiters[priority][:i], l.waiters[priority][i+1:]...)
+			return false
+		}
+	}
+	// 超时的同时锁已移交
+	return true
+}
+
+// unlock 释放写锁, 有等待者时直接移交
+func (l *writeLock) unlock() {
+	l.mu.Lock()
+	next := l.next()
+	if next < 0 {
+		l.busy = false
+		l.mu.Unlock()
+		return
+	}
+	ch := l.waiters[next][0]
+	l.waiters[next][0] = nil
+	l.waiters[next] = l.waiters[next][1:]
+	l.mu.Unlock()
+	close(ch)
+}
+
+// next 选择下一个获得锁的优先级, 没有等待者时返回-1
+func (l *writeLock) next() int {
+	chosen := -1
+	for p := range numPriorities {
+		if len(l.waiters[p]) == 0 {
+			continue
+		}
+		if l.skipped[p] >= starvationLimit {
+			chosen = p
+			break
+		}
+		if chosen < 0 {
+			chosen = p
+		}
+	}
+	if chosen < 0 {
+		return -1
+	}
+	l.skipped[chosen] = 0
+	for p := chosen + 1; p < numPriorities; p++ {
+		if len(l.waiters[p]) > 0 {
+			l.skipped[p]++
+		}
+	}
+	return chosen
+}
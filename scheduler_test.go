@@ -0,0 +1,118 @@
+package snet
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// waiting 等待写锁的数量
+func (l *writeLock) waiting() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, waiters := range l.waiters {
+		n += len(waiters)
+	}
+	return n
+}
+
+func TestWriteLockPriorityOrder(t *testing.T) {
+	var l writeLock
+	l.lock(PriorityInteractive)
+
+	var mu sync.Mutex
+	var order []Priority
+	var wg sync.WaitGroup
+	// 按低到高的顺序到达
+	for i, priority := range []Priority{PriorityBulk, PriorityInteractive, PriorityControl} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.lock(priority)
+			mu.Lock()
+			order = append(order, priority)
+			mu.Unlock()
+			l.unlock()
+		}()
+		waitFor(t, "waiter queued", func() bool { return l.waiting() == i+1 })
+	}
+	l.unlock()
+	wg.Wait()
+
+	want := []Priority{PriorityControl, PriorityInteractive, PriorityBulk}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("acquired in order %v, want %v", order, want)
+		}
+	}
+}
+
+func TestWriteLockStarvation(t *testing.T) {
+	l := writeLock{busy: true}
+	bulk := make(chan struct{})
+	l.waiters[PriorityBulk] = []chan struct{}{bulk}
+	for range 2 * starvationLimit {
+		l.waiters[PriorityControl] = append(l.waiters[PriorityControl], make(chan struct{}))
+	}
+
+	// 低优先级等待者被越过starvationLimit次后获得锁
+	for i := range starvationLimit + 1 {
+		l.unlock()
+		select {
+		case <-bulk:
+			if i != starvationLimit {
+				t.Fatalf("bulk waiter served after %d control waiters, want %d", i, starvationLimit)
+			}
+			return
+		default:
+		}
+	}
+	t.Fatal("bulk waiter starved")
+}
+
+func TestWriteLockTimeout(t *testing.T) {
+	var l writeLock
+	if !l.lockTimeout(PriorityBulk, time.Millisecond) {
+		t.Fatal("lockTimeout failed on a free lock")
+	}
+	if l.lockTimeout(PriorityControl, 10*time.Millisecond) {
+		t.Fatal("lockTimeout succeeded on a held lock")
+	}
+	if n := l.waiting(); n != 0 {
+		t.Fatalf("%d waiters left after timeout", n)
+	}
+	l.unlock()
+	if !l.lockTimeout(PriorityControl, time.Millisecond) {
+		t.Fatal("lockTimeout failed after unlock")
+	}
+	l.unlock()
+}
+
+func TestPriorityTable(t *testing.T) {
+	table := newPriorityTable()
+	window := NewPacket(PacketTypeFileData, nil, 0)
+	window.Header.Flags = flagStreamWindow
+	for _, tc := range []struct {
+		packet *Packet
+		want   Priority
+	}{
+		{NewPacket(PacketTypeHeartbeat, nil, 0), PriorityControl},
+		{NewPacket(PacketTypeChat, nil, 0), PriorityInteractive},
+		{NewPacket(PacketTypeFileData, nil, 0), PriorityBulk},
+		{window, PriorityControl},
+	} {
+		if got := table.of(tc.packet); got != tc.want {
+			t.Errorf("type %d flags %d: priority %d, want %d", tc.packet.Header.Type, tc.packet.Header.Flags, got, tc.want)
+		}
+	}
+
+	table.set(PacketTypeChat, PriorityBulk)
+	table.set(PacketTypeVideo, Priority(9))
+	if table.ofType(PacketTypeChat) != PriorityBulk || table.ofType(PacketTypeVideo) != PriorityBulk {
+		t.Fatal("set priority not applied")
+	}
+	if defaultPriorities.ofType(PacketTypeChat) != PriorityInteractive {
+		t.Fatal("table shares state with the defaults")
+	}
+}
@@ -1,9 +1,9 @@
 package snet
 
 import (
+	"context"
 	"crypto/tls"
-	"io"
-	"log"
+	"log/slog"
 	"net"
 	"sync"
 	"time"
@@ -13,10 +13,25 @@ import (
 type Server struct {
 	addr           string
 	listener       net.Listener
-	handlers       map[PacketType]Handler // 基于包类型的handler映射
-	defaultHandler Handler                // 默认handler
+	handlers       map[PacketType]Handler      // 基于包类型的handler映射
+	taskPriorities map[PacketType]TaskPriority // 基于包类型的任务优先级
+	defaultHandler Handler                     // 默认handler
 	workerPool     *WorkerPool
 	connManager    *ConnManager
+	rpc            *rpcServer                   // RPC服务注册表, 首次Register时创建
+	streamHandlers map[PacketType]StreamHandler // 基于包类型的流处理器
+	priorities     *priorityTable               // 出站包类型优先级
+	asyncWrite     *AsyncWriteConfig            // 异步发送配置, nil表示同步发送
+	groups         *GroupManager                // 房间管理, 首次调用Groups时创建
+	pubsub         *PubSub                      // 发布订阅, 首次调用PubSub时创建
+	authGate       *authGate                    // 认证关卡, nil表示不要求认证
+	authorizer     *authorizer                  // 授权策略, nil表示不做授权检查
+	limiter        *rateLimiter                 // 限流器, nil表示不限流
+	readLimits     *ReadLimits                  // 读取数据包的资源限制
+	inflight       *memoryBudget                // 所有连接共享的内存预算, nil表示不限制
+	hooks          lifecycleHooks               // 连接生命周期回调
+	logger         *slog.Logger                 // 日志记录器, 默认不输出
+	metrics        *serverMetrics               // 运行指标
 	mu             sync.RWMutex
 	running        bool
 }
@@ -33,13 +48,39 @@ func (f HandlerFunc) Handle(conn *Conn, packet *Packet) {
 	f(conn, packet)
 }
 
+// HandlerOption handler选项
+type HandlerOption func(o *handlerOptions)
+
+// handlerOptions handler选项
+type handlerOptions struct {
+	priority TaskPriority
+}
+
+// WithTaskPriority 该包类型的任务在协程池中的优先级, 默认TaskPriorityNormal,
+// 登录、登出和认证包默认为TaskPriorityHigh
+func WithTaskPriority(priority TaskPriority) HandlerOption {
+	return func(o *handlerOptions) {
+		o.priority = priority
+	}
+}
+
 // NewServer 创建服务器
 func NewServer(addr string) *Server {
 	return &Server{
-		addr:        addr,
-		handlers:    make(map[PacketType]Handler),
-		workerPool:  newWorkerPool(100, 1000),
-		connManager: NewConnManager(),
+		addr:     addr,
+		handlers: make(map[PacketType]Handler),
+		taskPriorities: map[PacketType]TaskPriority{
+			PacketTypeLogin:  TaskPriorityHigh,
+			PacketTypeLogout: TaskPriorityHigh,
+			PacketTypeAuth:   TaskPriorityHigh,
+		},
+		streamHandlers: make(map[PacketType]StreamHandler),
+		workerPool:     newWorkerPool(100, 1000),
+		connManager:    NewConnManager(),
+		priorities:     newPriorityTable(),
+		readLimits:     &defaultReadLimits,
+		logger:         discardLogger,
+		metrics:        newServerMetrics(),
 	}
 }
 
@@ -50,24 +91,66 @@ func (s *Server) SetHandler(handler Handler) *Server {
 }
 
 // AddHandler 添加基于包类型的handler
-func (s *Server) AddHandler(packetType PacketType, handler Handler) *Server {
+func (s *Server) AddHandler(packetType PacketType, handler Handler, opts ...HandlerOption) *Server {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.handlers[packetType] = handler
+	if len(opts) > 0 {
+		o := handlerOptions{priority: TaskPriorityNormal}
+		for _, opt := range opts {
+			opt(&o)
+		}
+		s.taskPriorities[packetType] = o.priority
+	}
 	return s
 }
 
 // AddHandlerFunc 添加基于包类型的handler函数
-func (s *Server) AddHandlerFunc(packetType PacketType, handlerFunc func(conn *Conn, packet *Packet)) *Server {
-	return s.AddHandler(packetType, HandlerFunc(handlerFunc))
+func (s *Server) AddHandlerFunc(packetType PacketType, handlerFunc func(conn *Conn, packet *Packet), opts ...HandlerOption) *Server {
+	return s.AddHandler(packetType, HandlerFunc(handlerFunc), opts...)
 }
 
-// SetWorkerPool 设置工作池
+// AddStreamHandler 添加基于包类型的流处理器, 客户端以该包类型打开流时调用
+func (s *Server) AddStreamHandler(packetType PacketType, handler StreamHandler) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streamHandlers[packetType] = handler
+	return s
+}
+
+// AddStreamHandlerFunc 添加基于包类型的流处理器函数
+func (s *Server) AddStreamHandlerFunc(packetType PacketType, handlerFunc func(stream *Stream)) *Server {
+	return s.AddStreamHandler(packetType, StreamHandlerFunc(handlerFunc))
+}
+
+// SetPacketPriority 设置包类型的出站优先级, 同一连接上高优先级的包先写出
+func (s *Server) SetPacketPriority(packetType PacketType, priority Priority) *Server {
+	s.priorities.set(packetType, priority)
+	return s
+}
+
+// SetWorkerPool 设置固定大小的工作池, maxQueueSize为各优先级任务队列的总容量
 func (s *Server) SetWorkerPool(workers, maxQueueSize int) *Server {
 	s.workerPool = newWorkerPool(workers, maxQueueSize)
 	return s
 }
 
+// SetWorkerPoolConfig 设置可伸缩的工作池
+func (s *Server) SetWorkerPoolConfig(cfg PoolConfig) *Server {
+	s.workerPool = NewWorkerPool(cfg)
+	return s
+}
+
+// WorkerPool 服务器的工作池, 可在运行时调用Resize调整协程数
+func (s *Server) WorkerPool() *WorkerPool {
+	return s.workerPool
+}
+
+// ConnManager 服务器的连接管理器, 可按连接ID或用户标识查找连接
+func (s *Server) ConnManager() *ConnManager {
+	return s.connManager
+}
+
 // getHandler 获取对应的handler
 func (s *Server) getHandler(packetType PacketType) Handler {
 	s.mu.RLock()
@@ -79,15 +162,30 @@ func (s *Server) getHandler(packetType PacketType) Handler {
 	return s.defaultHandler
 }
 
+// openStream 为对端打开的流启动处理器
+func (s *Server) openStream(stream *Stream) bool {
+	s.mu.RLock()
+	handler := s.streamHandlers[stream.Type()]
+	s.mu.RUnlock()
+
+	if handler == nil {
+		return false
+	}
+	go func() {
+		handler.HandleStream(stream)
+		stream.CloseSend()
+		stream.release()
+	}()
+	return true
+}
+
 // Start 启动服务器
 func (s *Server) Start() error {
 	var err error
 	var listener net.Listener
 	if serverAuthConfig != nil {
-		log.Println("加载证书启动")
 		listener, err = tls.Listen("tcp", s.addr, serverAuthConfig)
 	} else {
-		log.Println("未加载证书启动")
 		listener, err = net.Listen("tcp", s.addr)
 	}
 	if err != nil {
@@ -95,7 +193,7 @@ func (s *Server) Start() error {
 	}
 
 	// 检查是否有handler设置
-	if len(s.handlers) == 0 && s.defaultHandler == nil {
+	if len(s.handlers) == 0 && len(s.streamHandlers) == 0 && s.defaultHandler == nil {
 		return ErrServerHandlerNotSet
 	}
 	if s.workerPool == nil {
@@ -105,9 +203,10 @@ func (s *Server) Start() error {
 	s.mu.Lock()
 	s.listener = listener
 	s.running = true
+	logger := s.logger
 	s.mu.Unlock()
 
-	log.Printf("Server started on %s\n", s.addr)
+	logger.Info("server started", slog.String("addr", listener.Addr().String()), slog.Bool("tls", serverAuthConfig != nil))
 
 	for {
 		conn, err := listener.Accept()
@@ -119,74 +218,250 @@ func (s *Server) Start() error {
 			if !running {
 				break
 			}
+			logger.Warn("accept failed", slog.Any("error", err))
+			continue
+		}
+
+		s.mu.RLock()
+		limiter := s.limiter
+		s.mu.RUnlock()
+		if limiter != nil && !limiter.admit(remoteIP(conn)) {
+			logger.Warn("connection rejected by limit", slog.String("remote_addr", conn.RemoteAddr().String()))
+			s.metrics.rejected.Add(1)
+			conn.Close()
 			continue
 		}
+		s.metrics.accepted.Add(1)
 
-		go s.handleConnection(conn)
+		go s.handleConnection(conn, limiter)
 	}
 
 	return nil
 }
 
 // handleConnection 处理连接
-func (s *Server) handleConnection(netConn net.Conn) {
+func (s *Server) handleConnection(netConn net.Conn, limiter *rateLimiter) {
+	// Start中admit占用的连接数在任何退出路径上都要释放, 包括握手失败
+	var ip string
+	if limiter != nil {
+		ip = remoteIP(netConn)
+		defer limiter.release(ip)
+	}
+
 	// 设置连接超时
 	netConn.SetReadDeadline(time.Now().Add(60 * time.Second))
 
 	conn := newConn(netConn)
+	conn.metrics = s.metrics
+	s.mu.RLock()
+	conn.setLogger(s.logger)
+	s.mu.RUnlock()
+	// 在读取数据前完成TLS握手, 使handler能拿到对端身份
+	if err := conn.handshake(); err != nil {
+		conn.logger.Warn("tls handshake failed", slog.Any("error", err))
+		netConn.Close()
+		// 已计入accepted, 同样计入closed
+		conn.setCloseReason(closeReasonOf(err))
+		s.metrics.connClosed(conn.CloseReason())
+		return
+	}
+	conn.streams.onOpen = s.openStream
+	conn.priorities = s.priorities
+	s.mu.RLock()
+	asyncWrite := s.asyncWrite
+	s.mu.RUnlock()
+	if asyncWrite != nil {
+		conn.startAsyncWriter(*asyncWrite)
+	}
+	s.mu.RLock()
+	gate := s.authGate
+	s.mu.RUnlock()
+	if gate != nil {
+		gate.watch(conn)
+	}
+	var cl *connLimiter
+	if limiter != nil {
+		cl = limiter.forConn(ip)
+	}
+	s.mu.RLock()
+	reader := newPacketReader(conn, s.readLimits, s.inflight)
+	s.mu.RUnlock()
 	s.connManager.Add(conn)
-	defer s.connManager.Remove(conn)
-	defer conn.Close()
+	defer func() {
+		conn.Close()
+		s.connManager.Remove(conn)
+		conn.logger.Debug("connection closed", slog.String("reason", conn.CloseReason().String()))
+		s.metrics.connClosed(conn.CloseReason())
+		s.hooks.closed(conn)
+	}()
+	conn.logger.Debug("connection opened")
+	s.hooks.connected(conn)
 
 	for {
-		packet, err := conn.ReceivePacket()
+		packet, err := reader.receive()
 		if err != nil {
-			if err != io.EOF {
-				// fmt.Printf("Receive packet error: %v\n", err)
-				// 检查是否是超时错误
-				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-					log.Printf("Connection timeout: %v\n", err)
-				} else {
-					log.Printf("Receive packet error: %v\n", err)
-				}
+			s.metrics.decodeError(err)
+			switch reason := closeReasonOf(err); reason {
+			case CloseProtocolError:
+				conn.logger.Warn("invalid packet", slog.Any("error", err))
+				s.hooks.packetError(conn, nil, err)
+				conn.Disconnect(reason)
+			case CloseLimitExceeded:
+				conn.logger.Warn("read limit exceeded", slog.Any("error", err))
+				conn.Disconnect(reason)
+			case CloseTimeout:
+				conn.logger.Info("connection timeout", slog.Any("error", err))
+				conn.setCloseReason(reason)
+			case CloseNetworkError:
+				conn.logger.Warn("receive packet failed", slog.Any("error", err))
+				conn.setCloseReason(reason)
+			default:
+				conn.setCloseReason(reason)
 			}
 			break
 		}
 		// 每次成功接收数据后重置超时时间
 		netConn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		s.metrics.received(packet)
 
-		// 处理心跳包
-		if packet.Header.Type == PacketTypeHeartbeat {
-			log.Println(string(packet.Data))
+		if !s.handlePacket(conn, packet, gate, cl) {
+			break
+		}
+	}
+}
 
-			ackPacket := NewPacket(PacketTypeAck, []byte("Server Pong ..."), packet.Header.Seq)
-			conn.SendPacket(ackPacket)
-			continue
+// handlePacket 处理一个数据包, 返回false表示应断开连接.
+// 数据包交给协程池时由任务释放其内存预算, 流数据帧的预算转交给流, 否则在返回时释放
+func (s *Server) handlePacket(conn *Conn, packet *Packet, gate *authGate, cl *connLimiter) bool {
+	queued := false
+	defer func() {
+		if !queued {
+			packet.free()
 		}
+	}()
 
-		// 获取对应的handler
-		handler := s.getHandler(packet.Header.Type)
-		if handler == nil {
-			log.Printf("No handler found for packet type: %d\n", packet.Header.Type)
-			continue
+	// 对端告知关闭原因后断开
+	if packet.Header.Type == PacketTypeDisconnect && packet.Header.Stream == 0 {
+		conn.setCloseReason(disconnectReason(packet))
+		return false
+	}
+
+	// 限流检查, 流的数据帧只在打开时计入
+	if cl != nil && (packet.Header.Stream == 0 || packet.Header.Flags&flagStreamOpen != 0) {
+		if !s.throttle(conn, packet, cl) {
+			if cl.action == LimitDisconnect {
+				conn.Disconnect(CloseLimitExceeded)
+				return false
+			}
+			return true
+		}
+	}
+
+	// 认证检查
+	if gate != nil {
+		if !gate.admit(conn, packet) {
+			s.reject(conn, packet, ErrAuthRequired)
+			return true
+		}
+		if packet.Header.Stream == 0 && gate.owns(packet.Header.Type) {
+			queued = s.submit(conn, packet, gate)
+			return true
+		}
+	}
+
+	// 流数据帧交给对应的流
+	if packet.Header.Stream != 0 {
+		if packet.Header.Flags&flagStreamOpen != 0 && !s.authorize(conn, packet) {
+			return true
+		}
+		conn.streams.dispatch(packet)
+		return true
+	}
+
+	// 处理心跳包
+	if packet.Header.Type == PacketTypeHeartbeat {
+		if conn.logger.Enabled(context.Background(), slog.LevelDebug) {
+			conn.logger.Debug("heartbeat", packetAttrs(packet)...)
 		}
 
-		// 提交到协程池处理
-		s.workerPool.Submit(func() {
+		ackPacket := NewPacket(PacketTypeAck, []byte("Server Pong ..."), packet.Header.Seq)
+		conn.SendPacket(ackPacket)
+		return true
+	}
+
+	if !s.authorize(conn, packet) {
+		return true
+	}
+
+	// 获取对应的handler
+	handler := s.getHandler(packet.Header.Type)
+	if handler == nil {
+		conn.logger.Warn("no handler for packet", packetAttrs(packet)...)
+		s.hooks.packetError(conn, packet, ErrHandlerNotFound)
+		return true
+	}
+
+	// 提交到协程池处理
+	queued = s.submit(conn, packet, handler)
+	return true
+}
+
+// submit 将数据包提交到协程池处理, 提交失败时回调OnPacketError
+func (s *Server) submit(conn *Conn, packet *Packet, handler Handler) bool {
+	s.mu.RLock()
+	priority, ok := s.taskPriorities[packet.Header.Type]
+	s.mu.RUnlock()
+	if !ok {
+		priority = TaskPriorityNormal
+	}
+
+	err := s.workerPool.submit(context.Background(), poolTask{
+		run: func() {
+			defer packet.free()
+			// handler panic时也记录耗时
+			defer func(start time.Time) {
+				s.metrics.handled(packet.Header.Type, time.Since(start))
+			}(time.Now())
 			handler.Handle(conn, packet)
-		})
+		},
+		priority:   priority,
+		packetType: packet.Header.Type,
+		connID:     conn.id,
+	}, false)
+	if err != nil {
+		conn.logger.Warn("submit packet failed", append(packetAttrs(packet), slog.Any("error", err))...)
+		s.hooks.packetError(conn, packet, err)
+		return false
+	}
+	return true
+}
+
+// reject 拒绝数据包: 普通包回复PacketTypeError, 流数据帧重置对应的流
+func (s *Server) reject(conn *Conn, packet *Packet, reason error) {
+	conn.logger.Debug("packet rejected", append(packetAttrs(packet), slog.Any("error", reason))...)
+	s.hooks.packetError(conn, packet, reason)
+	if packet.Header.Stream != 0 {
+		if packet.Header.Flags&flagStreamReset == 0 {
+			conn.streams.reset(packet.Header.Stream, packet.Header.Type)
+		}
+		return
 	}
+	conn.SendPacket(NewPacket(PacketTypeError, []byte(reason.Error()), packet.Header.Seq))
 }
 
 // Stop 停止服务器
 func (s *Server) Stop() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if s.running {
-		s.running = false
-		s.listener.Close()
-		s.workerPool.Close()
-		s.connManager.CloseAll()
+	if !s.running {
+		s.mu.Unlock()
+		return
 	}
+	s.running = false
+	listener, pool, manager := s.listener, s.workerPool, s.connManager
+	s.mu.Unlock()
+
+	// 等待handler返回时不能持有s.mu, handler中可能调用Groups、PubSub等方法
+	listener.Close()
+	pool.Close()
+	manager.CloseAll()
 }
@@ -0,0 +1,51 @@
+package snet
+
+import (
+	"testing"
+	"time"
+)
+
+// startServer 在随机端口启动服务器, 返回监听地址, 测试结束时停止服务器
+func startServer(t *testing.T, s *Server) string {
+	t.Helper()
+	s.addr = "127.0.0.1:0"
+	errc := make(chan error, 1)
+	go func() { errc <- s.Start() }()
+	for {
+		s.mu.RLock()
+		listener := s.listener
+		s.mu.RUnlock()
+		if listener != nil {
+			t.Cleanup(s.Stop)
+			return listener.Addr().String()
+		}
+		select {
+		case err := <-errc:
+			t.Fatalf("Start: %v", err)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// dialClient 连接服务器, 测试结束时关闭客户端
+func dialClient(t *testing.T, addr string) *Client {
+	t.Helper()
+	c := NewClient(addr)
+	if err := c.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// waitFor 等待条件成立, 超时后测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
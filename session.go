@@ -0,0 +1,130 @@
+package snet
+
+import (
+	"sync"
+	"time"
+)
+
+// Session 连接会话, 保存用户标识与任意属性, 可在多个handler中并发使用
+type Session struct {
+	mu        sync.RWMutex
+	userID    string
+	loginTime time.Time
+	createdAt time.Time
+	attrs     map[string]any
+	principal *Principal
+	onUser    func() // 用户标识变化时通知连接管理器更新索引
+}
+
+func newSession() *Session {
+	return &Session{
+		createdAt: time.Now(),
+		attrs:     make(map[string]any),
+	}
+}
+
+// UserID 绑定的用户标识, 未登录时为空
+func (s *Session) UserID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.userID
+}
+
+// SetUserID 绑定用户标识并记录登录时间, 传入空字符串解除绑定
+func (s *Session) SetUserID(userID string) {
+	s.mu.Lock()
+	s.userID = userID
+	if userID != "" {
+		s.loginTime = time.Now()
+	} else {
+		s.loginTime = time.Time{}
+	}
+	onUser := s.onUser
+	s.mu.Unlock()
+
+	if onUser != nil {
+		onUser()
+	}
+}
+
+// Principal 认证通过的身份, 未认证时为nil
+func (s *Session) Principal() *Principal {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.principal
+}
+
+// Authenticated 是否已认证
+func (s *Session) Authenticated() bool {
+	return s.Principal() != nil
+}
+
+// SetPrincipal 设置认证身份并以身份标识作为用户标识, 传入nil清除认证状态
+func (s *Session) SetPrincipal(principal *Principal) {
+	s.mu.Lock()
+	s.principal = principal
+	s.mu.Unlock()
+
+	if principal != nil {
+		s.SetUserID(principal.Name)
+	} else {
+		s.SetUserID("")
+	}
+}
+
+// LoginTime 绑定用户标识的时间
+func (s *Session) LoginTime() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.loginTime
+}
+
+// CreatedAt 连接建立时间
+func (s *Session) CreatedAt() time.Time {
+	return s.createdAt
+}
+
+// Set 设置属性
+func (s *Session) Set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs[key] = value
+}
+
+// Get 获取属性
+func (s *Session) Get(key string) (any, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.attrs[key]
+	return value, ok
+}
+
+// Delete 删除属性
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attrs, key)
+}
+
+// Range 遍历属性, fn返回false时停止
+func (s *Session) Range(fn func(key string, value any) bool) {
+	s.mu.RLock()
+	attrs := make(map[string]any, len(s.attrs))
+	for k, v := range s.attrs {
+		attrs[k] = v
+	}
+	s.mu.RUnlock()
+
+	for k, v := range attrs {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// setOnUser 设置用户标识变化的回调
+func (s *Session) setOnUser(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onUser = fn
+}
@@ -0,0 +1,103 @@
+package snet
+
+import "testing"
+
+func TestSessionAttributes(t *testing.T) {
+	s := newSession()
+	if s.UserID() != "" || !s.LoginTime().IsZero() || s.CreatedAt().IsZero() {
+		t.Fatal("new session state")
+	}
+
+	s.Set("room", "lobby")
+	s.Set("level", 3)
+	if v, ok := s.Get("room"); !ok || v != "lobby" {
+		t.Fatalf("Get(room) = %v, %v", v, ok)
+	}
+	s.Delete("room")
+	if _, ok := s.Get("room"); ok {
+		t.Fatal("attribute not deleted")
+	}
+	n := 0
+	s.Range(func(key string, value any) bool {
+		// 遍历快照, 回调中可以修改属性
+		s.Set("seen", true)
+		n++
+		return true
+	})
+	if n != 1 {
+		t.Fatalf("Range visited %d attributes, want 1", n)
+	}
+
+	s.SetUserID("alice")
+	if s.UserID() != "alice" || s.LoginTime().IsZero() {
+		t.Fatal("user not bound")
+	}
+	s.SetUserID("")
+	if s.UserID() != "" || !s.LoginTime().IsZero() {
+		t.Fatal("user not unbound")
+	}
+
+	s.SetPrincipal(&Principal{Name: "bob"})
+	if !s.Authenticated() || s.UserID() != "bob" {
+		t.Fatal("principal not applied")
+	}
+	s.SetPrincipal(nil)
+	if s.Authenticated() || s.UserID() != "" {
+		t.Fatal("principal not cleared")
+	}
+}
+
+func TestConnManagerUserIndex(t *testing.T) {
+	cm := NewConnManager()
+	a, b := pipeConn(t), pipeConn(t)
+	a.Session().SetUserID("alice")
+	cm.Add(a)
+	cm.Add(b)
+
+	if conns := cm.GetByUser("alice"); len(conns) != 1 || conns[0] != a {
+		t.Fatalf("user bound before Add not indexed: %v", conns)
+	}
+	if cm.GetByID(b.ID()) != b || cm.Get(b.Conn) != b {
+		t.Fatal("lookup by id or net.Conn failed")
+	}
+
+	// 加入管理器后绑定、切换和解除用户标识都会更新索引
+	b.Session().SetUserID("alice")
+	if n := len(cm.GetByUser("alice")); n != 2 {
+		t.Fatalf("alice has %d connections, want 2", n)
+	}
+	a.Session().SetUserID("carol")
+	if n := len(cm.GetByUser("alice")); n != 1 {
+		t.Fatalf("alice has %d connections after rebind, want 1", n)
+	}
+	b.Session().SetUserID("")
+	if n := len(cm.GetByUser("alice")); n != 0 {
+		t.Fatalf("alice has %d connections after unbind, want 0", n)
+	}
+
+	matched := cm.Filter(func(conn *Conn) bool { return conn.Session().UserID() == "carol" })
+	if len(matched) != 1 || matched[0] != a {
+		t.Fatalf("Filter = %v", matched)
+	}
+	visited := 0
+	cm.ForEach(func(conn *Conn) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Fatalf("ForEach visited %d after returning false", visited)
+	}
+
+	var removed []*Conn
+	cm.OnRemove(func(conn *Conn) { removed = append(removed, conn) })
+	cm.Remove(a)
+	cm.Remove(a)
+	if len(removed) != 1 || cm.Count() != 1 || len(cm.GetByUser("carol")) != 0 {
+		t.Fatalf("after Remove: %d hooks, count %d", len(removed), cm.Count())
+	}
+	// 移除后会话的变化不再影响索引
+	a.Session().SetUserID("carol")
+	if len(cm.GetByUser("carol")) != 0 {
+		t.Fatal("removed connection indexed again")
+	}
+}
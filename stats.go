@@ -0,0 +1,111 @@
+package snet
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// defaultBuckets 耗时直方图的默认桶上界
+var defaultBuckets = []time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// histogram 并发安全的耗时直方图
+type histogram struct {
+	bounds []time.Duration
+	counts []atomic.Uint64 // 比bounds多一个桶, 记录超出最大上界的样本
+	sum    atomic.Int64
+}
+
+func newHistogram(bounds []time.Duration) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]atomic.Uint64, len(bounds)+1),
+	}
+}
+
+// observe 记录一个样本
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(h.bounds) && d > h.bounds[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+}
+
+// snapshot 当前数据的快照
+func (h *histogram) snapshot() HistogramSnapshot {
+	s := HistogramSnapshot{
+		Bounds: h.bounds,
+		Counts: make([]uint64, len(h.counts)),
+		Sum:    time.Duration(h.sum.Load()),
+	}
+	for i := range h.counts {
+		s.Counts[i] = h.counts[i].Load()
+		s.Count += s.Counts[i]
+	}
+	return s
+}
+
+// HistogramSnapshot 耗时直方图快照
+type HistogramSnapshot struct {
+	Bounds []time.Duration // 各桶的上界(包含)
+	Counts []uint64        // 各桶的样本数, 最后一个桶为超出最大上界的样本
+	Count  uint64          // 样本总数
+	Sum    time.Duration   // 样本总耗时
+}
+
+// Mean 平均耗时
+func (s HistogramSnapshot) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / time.Duration(s.Count)
+}
+
+// Quantile 分位数的近似值, 取所在桶的上界; 落在最后一个桶时返回最大上界
+func (s HistogramSnapshot) Quantile(q float64) time.Duration {
+	if s.Count == 0 || len(s.Bounds) == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(s.Count))
+	var seen uint64
+	for i, n := range s.Counts {
+		seen += n
+		if seen > rank && i < len(s.Bounds) {
+			return s.Bounds[i]
+		}
+	}
+	return s.Bounds[len(s.Bounds)-1]
+}
+
+// ServerStats 服务器运行状态
+type ServerStats struct {
+	Connections int       // 当前连接数
+	WorkerPool  PoolStats // 工作池状态
+}
+
+// Stats 服务器运行状态
+func (s *Server) Stats() ServerStats {
+	return ServerStats{
+		Connections: s.connManager.Count(),
+		WorkerPool:  s.workerPool.Stats(),
+	}
+}
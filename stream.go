@@ -0,0 +1,657 @@
+package snet
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// 流控制标志
+const (
+	flagStreamOpen   uint8 = 1 << iota // 打开流
+	flagStreamClose                    // 发送方半关闭
+	flagStreamReset                    // 取消流
+	flagStreamWindow                   // 接收窗口更新
+	flagStreamMore                     // 消息未结束, 后续还有分片
+)
+
+const (
+	streamWindowSize     = 256 * 1024 // 每个流的初始接收窗口(字节)
+	streamFrameSize      = 32 * 1024  // 单帧最大数据量, 大消息拆分为多帧与其他流交错发送
+	maxConcurrentStreams = 256        // 每个连接上对端可同时打开的流数量
+	channelBacklog       = 64         // 等待AcceptChannel的通道数量
+
+	// streamMaxBuffered 每个流缓冲的最大字节数: 未读取的消息受接收窗口限制, 另加一条重组中的消息
+	streamMaxBuffered = MaxPacketSize + 2*streamWindowSize
+)
+
+// StreamHandler 流处理器接口, 处理器返回时流的发送方向自动关闭
+type StreamHandler interface {
+	HandleStream(stream *Stream)
+}
+
+// StreamHandlerFunc 流处理器函数类型
+type StreamHandlerFunc func(stream *Stream)
+
+func (f StreamHandlerFunc) HandleStream(stream *Stream) {
+	f(stream)
+}
+
+// Stream 复用在连接上的双向流, Send和Recv可分别在不同协程中调用
+type Stream struct {
+	id     uint32
+	ptype  PacketType
+	table  *streamTable
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	stop   func() bool // 解除对调用方ctx的监听
+
+	sendMu        sync.Mutex // 保证同一消息的分片连续
+	mu            sync.Mutex
+	seq           uint32
+	recvBuf       []recvItem
+	partial       []byte  // 重组中的消息
+	partialCredit int     // 重组中的消息尚未释放的接收窗口
+	partialCharge charges // 重组中的消息占用的内存预算
+	buffered      int     // recvBuf和partial中的字节数
+	waiting       bool    // Recv正在等待下一条消息
+	recvBytes     int     // 缓冲中未通告给对端的字节数
+	unacked       int     // 已读取但未通告给对端的字节数
+	sendWindow    int64   // 对端剩余接收窗口
+	localClosed   bool
+	remoteClosed  bool
+	err           error
+	recvNotify    chan struct{}
+	sendNotify    chan struct{}
+}
+
+func newStream(table *streamTable, parent context.Context, id uint32, ptype PacketType) *Stream {
+	ctx, cancel := context.WithCancelCause(parent)
+	return &Stream{
+		id:         id,
+		ptype:      ptype,
+		table:      table,
+		ctx:        ctx,
+		cancel:     cancel,
+		stop:       func() bool { return false },
+		sendWindow: streamWindowSize,
+		recvNotify: make(chan struct{}, 1),
+		sendNotify: make(chan struct{}, 1),
+	}
+}
+
+// ID 流ID
+func (s *Stream) ID() uint32 {
+	return s.id
+}
+
+// Type 打开流时指定的包类型
+func (s *Stream) Type() PacketType {
+	return s.ptype
+}
+
+// Conn 流所在的连接
+func (s *Stream) Conn() *Conn {
+	return s.table.conn
+}
+
+// Context 流结束、被取消或连接断开时结束
+func (s *Stream) Context() context.Context {
+	return s.ctx
+}
+
+// recvItem 已重组完成、等待Recv读取的消息
+type recvItem struct {
+	packet *Packet
+	credit int     // 读取后需通告给对端的字节数, 包含该消息全部分片中尚未释放的部分
+	charge charges // 消息各分片占用的内存预算, Recv交给应用时释放
+}
+
+// charges 缓冲的数据占用的内存预算, 数据交给应用或流结束时释放
+type charges []func()
+
+// add 添加一个数据包的预算释放函数
+func (c charges) add(release func()) charges {
+	if release == nil {
+		return c
+	}
+	return append(c, release)
+}
+
+// free 释放全部预算
+func (c charges) free() {
+	for _, release := range c {
+		release()
+	}
+}
+
+// Send 以打开流时的包类型发送一条消息, 对端接收窗口耗尽时阻塞
+func (s *Stream) Send(data []byte) error {
+	return s.SendPacket(s.ptype, data)
+}
+
+// SendPacket 以指定包类型发送一条消息, 大消息按帧拆分发送
+func (s *Stream) SendPacket(packetType PacketType, data []byte) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	for {
+		n := min(len(data), streamFrameSize)
+		var flags uint8
+		if n < len(data) {
+			flags = flagStreamMore
+		}
+		if err := s.sendFrame(packetType, flags, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+		if len(data) == 0 {
+			return nil
+		}
+	}
+}
+
+// sendFrame 等待接收窗口后发送一帧
+func (s *Stream) sendFrame(packetType PacketType, flags uint8, data []byte) error {
+	for {
+		s.mu.Lock()
+		if s.err != nil {
+			err := s.err
+			s.mu.Unlock()
+			return err
+		}
+		if s.localClosed {
+			s.mu.Unlock()
+			return ErrStreamClosed
+		}
+		if s.sendWindow > 0 {
+			s.sendWindow -= int64(len(data))
+			packet := s.frame(packetType, flags, data)
+			s.mu.Unlock()
+			return s.table.conn.SendPacket(packet)
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.sendNotify:
+		case <-s.ctx.Done():
+			if err := s.failure(); err != nil {
+				return err
+			}
+			return context.Cause(s.ctx)
+		}
+	}
+}
+
+// Recv 接收一条消息, 对端关闭发送方向后返回io.EOF.
+// 消息被读取后才释放其占用的接收窗口, 不读取的流最多缓冲一个窗口的消息
+func (s *Stream) Recv() (*Packet, error) {
+	for {
+		s.mu.Lock()
+		s.waiting = false
+		if len(s.recvBuf) > 0 {
+			item := s.recvBuf[0]
+			s.recvBuf[0] = recvItem{}
+			s.recvBuf = s.recvBuf[1:]
+			s.buffered -= len(item.packet.Data)
+			update := s.credit(item.credit)
+			if len(s.recvBuf) == 0 && s.partialCharge == nil {
+				s.table.unhold(s)
+			}
+			s.mu.Unlock()
+
+			item.charge.free()
+			if update != nil {
+				s.table.conn.SendPacket(update)
+			}
+			return item.packet, nil
+		}
+		if s.err != nil {
+			err := s.err
+			s.mu.Unlock()
+			return nil, err
+		}
+		if s.remoteClosed {
+			s.mu.Unlock()
+			return nil, io.EOF
+		}
+		// 没有已重组的消息时, 重组中的消息就是下一条要读取的消息, 释放其分片占用的窗口,
+		// 使超过接收窗口的大消息能够继续传输
+		var update *Packet
+		if s.partialCredit > 0 {
+			update = s.credit(s.partialCredit)
+			s.partialCredit = 0
+		}
+		s.waiting = true
+		s.mu.Unlock()
+
+		if update != nil {
+			s.table.conn.SendPacket(update)
+		}
+		select {
+		case <-s.recvNotify:
+		case <-s.ctx.Done():
+			if err := s.failure(); err != nil {
+				return nil, err
+			}
+			return nil, context.Cause(s.ctx)
+		}
+	}
+}
+
+// CloseSend 关闭发送方向, 对端读完后收到io.EOF
+func (s *Stream) CloseSend() error {
+	s.mu.Lock()
+	if s.localClosed || s.err != nil {
+		s.mu.Unlock()
+		return nil
+	}
+	s.localClosed = true
+	packet := s.frame(s.ptype, flagStreamClose, nil)
+	s.mu.Unlock()
+
+	err := s.table.conn.SendPacket(packet)
+	s.finishIfDone()
+	return err
+}
+
+// Cancel 取消流, 通知对端丢弃该流
+func (s *Stream) Cancel() {
+	if s.abort(context.Canceled) {
+		s.sendReset()
+	}
+}
+
+// sendReset 通知对端取消流
+func (s *Stream) sendReset() {
+	s.mu.Lock()
+	packet := s.frame(s.ptype, flagStreamReset, nil)
+	s.mu.Unlock()
+	s.table.conn.SendPacket(packet)
+}
+
+// credit 释放接收窗口, 累计过半窗口后返回需发送的窗口更新帧, 调用方需持有s.mu
+func (s *Stream) credit(n int) *Packet {
+	s.recvBytes -= n
+	s.unacked += n
+	if s.unacked < streamWindowSize/2 || s.remoteClosed || s.err != nil {
+		return nil
+	}
+	var delta [4]byte
+	binary.BigEndian.PutUint32(delta[:], uint32(s.unacked))
+	s.unacked = 0
+	return s.frame(s.ptype, flagStreamWindow, delta[:])
+}
+
+// frame 构造流数据帧, 调用方需持有s.mu
+func (s *Stream) frame(packetType PacketType, flags uint8, data []byte) *Packet {
+	s.seq++
+	packet := NewPacket(packetType, data, s.seq)
+	packet.Header.Stream = s.id
+	packet.Header.Flags = flags
+	return packet
+}
+
+// failure 流的失败原因
+func (s *Stream) failure() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// abort 以错误结束流, 返回是否由本次调用结束
+func (s *Stream) abort(err error) bool {
+	defer s.uncharge()
+	s.mu.Lock()
+	if s.err != nil || (s.localClosed && s.remoteClosed) {
+		s.mu.Unlock()
+		return false
+	}
+	s.err = err
+	stop := s.stop
+	s.mu.Unlock()
+
+	s.table.remove(s.id)
+	stop()
+	s.cancel(err)
+	return true
+}
+
+// uncharge 释放缓冲的数据占用的内存预算, 数据仍可由Recv读取.
+// 流结束后应用可能不再读取, 此时不能继续占用连接和服务器的预算
+func (s *Stream) uncharge() {
+	s.mu.Lock()
+	charge := s.partialCharge
+	s.partialCharge = nil
+	for i := range s.recvBuf {
+		charge = append(charge, s.recvBuf[i].charge...)
+		s.recvBuf[i].charge = nil
+	}
+	if charge != nil {
+		s.table.unhold(s)
+	}
+	s.mu.Unlock()
+
+	charge.free()
+}
+
+// push 收到对端数据. 数据包占用的内存预算转交给流, 直到Recv将消息交给应用
+func (s *Stream) push(packet *Packet) {
+	release := packet.release
+	packet.release = nil
+
+	s.mu.Lock()
+	if s.err != nil || s.remoteClosed {
+		s.mu.Unlock()
+		if release != nil {
+			release()
+		}
+		return
+	}
+	n := len(packet.Data)
+	s.recvBytes += n
+	s.buffered += n
+
+	// 对端无视接收窗口或消息超出大小限制
+	if s.recvBytes > 2*streamWindowSize || s.buffered > streamMaxBuffered || len(s.partial)+n > MaxPacketSize {
+		s.mu.Unlock()
+		if release != nil {
+			release()
+		}
+		if s.abort(ErrStreamFlowControl) {
+			s.sendReset()
+		}
+		return
+	}
+	if release != nil {
+		s.table.hold(s)
+	}
+
+	// 分片的窗口在消息被读取时释放; Recv正在等待这条消息时立即释放, 重组缓冲受MaxPacketSize限制
+	if packet.Header.Flags&flagStreamMore != 0 {
+		s.partial = append(s.partial, packet.Data...)
+		s.partialCharge = s.partialCharge.add(release)
+		var update *Packet
+		if s.waiting && len(s.recvBuf) == 0 {
+			update = s.credit(n)
+		} else {
+			s.partialCredit += n
+		}
+		s.mu.Unlock()
+		if update != nil {
+			s.table.conn.SendPacket(update)
+		}
+		return
+	}
+	credit := s.partialCredit + n
+	s.partialCredit = 0
+	charge := s.partialCharge.add(release)
+	s.partialCharge = nil
+	if s.partial != nil {
+		packet.Data = append(s.partial, packet.Data...)
+		packet.Header.Length = uint32(len(packet.Data))
+		packet.Header.Checksum = calculateChecksum(packet.Data)
+		s.partial = nil
+	}
+	packet.Header.Flags = 0
+	s.recvBuf = append(s.recvBuf, recvItem{packet: packet, credit: credit, charge: charge})
+	s.mu.Unlock()
+
+	notify(s.recvNotify)
+}
+
+// remoteClose 对端关闭发送方向
+func (s *Stream) remoteClose() {
+	s.mu.Lock()
+	s.remoteClosed = true
+	s.mu.Unlock()
+
+	notify(s.recvNotify)
+	s.finishIfDone()
+}
+
+// addWindow 对端通告接收窗口
+func (s *Stream) addWindow(delta uint32) {
+	s.mu.Lock()
+	s.sendWindow += int64(delta)
+	s.mu.Unlock()
+	notify(s.sendNotify)
+}
+
+// finishIfDone 双向都关闭后从连接上移除
+func (s *Stream) finishIfDone() {
+	s.mu.Lock()
+	done := s.localClosed && s.remoteClosed && s.err == nil
+	stop := s.stop
+	s.mu.Unlock()
+
+	if done {
+		s.table.remove(s.id)
+		stop()
+		s.cancel(ErrStreamClosed)
+	}
+}
+
+// release 处理器返回后释放流, 对端之后发来的数据会被重置
+func (s *Stream) release() {
+	defer s.uncharge()
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = ErrStreamClosed
+	}
+	stop := s.stop
+	s.mu.Unlock()
+
+	s.table.remove(s.id)
+	stop()
+	s.cancel(ErrStreamClosed)
+}
+
+// notify 非阻塞唤醒等待者
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// streamTable 连接上的流表
+type streamTable struct {
+	conn    *Conn
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+	nextID  uint32 // 客户端使用奇数ID, 服务端使用偶数ID
+	remote  int    // 对端打开的流数量
+	err     error  // 连接已断开
+	onOpen  func(stream *Stream) bool
+	backlog chan *Stream         // 等待AcceptChannel的通道
+	holding map[*Stream]struct{} // 缓冲中有数据占用内存预算的流, 包括已结束但未读完的流
+}
+
+func newStreamTable(conn *Conn) *streamTable {
+	return &streamTable{
+		conn:    conn,
+		streams: make(map[uint32]*Stream),
+		backlog: make(chan *Stream, channelBacklog),
+	}
+}
+
+// setClient 本端为客户端, 使用奇数流ID
+func (t *streamTable) setClient() {
+	t.mu.Lock()
+	t.nextID = 1
+	t.mu.Unlock()
+}
+
+// open 打开一条新流
+func (t *streamTable) open(ctx context.Context, ptype PacketType) (*Stream, error) {
+	t.mu.Lock()
+	if t.err != nil {
+		t.mu.Unlock()
+		return nil, t.err
+	}
+	if t.nextID == 0 {
+		t.nextID = 2
+	}
+	id := t.nextID
+	t.nextID += 2
+	stream := newStream(t, context.WithoutCancel(ctx), id, ptype)
+	t.streams[id] = stream
+	t.mu.Unlock()
+
+	// 调用方取消ctx时通知对端
+	stop := context.AfterFunc(ctx, func() {
+		if stream.abort(context.Cause(ctx)) {
+			stream.sendReset()
+		}
+	})
+	stream.mu.Lock()
+	stream.stop = stop
+	packet := stream.frame(ptype, flagStreamOpen, nil)
+	stream.mu.Unlock()
+
+	if err := stream.failure(); err != nil {
+		return nil, err
+	}
+	if err := t.conn.SendPacket(packet); err != nil {
+		stream.abort(err)
+		return nil, err
+	}
+	return stream, nil
+}
+
+// dispatch 将流数据帧分发给对应的流, 由连接的读循环调用
+func (t *streamTable) dispatch(packet *Packet) {
+	h := packet.Header
+	if h.Flags&flagStreamOpen != 0 {
+		t.accept(packet)
+		return
+	}
+
+	t.mu.Lock()
+	stream := t.streams[h.Stream]
+	t.mu.Unlock()
+
+	if stream == nil {
+		// 对端仍在向已结束的流发送数据
+		if h.Flags&(flagStreamReset|flagStreamWindow|flagStreamClose) == 0 {
+			t.reset(h.Stream, h.Type)
+		}
+		return
+	}
+
+	switch {
+	case h.Flags&flagStreamReset != 0:
+		stream.abort(ErrStreamReset)
+	case h.Flags&flagStreamWindow != 0:
+		if len(packet.Data) == 4 {
+			stream.addWindow(binary.BigEndian.Uint32(packet.Data))
+		}
+	case h.Flags&flagStreamClose != 0:
+		stream.remoteClose()
+	default:
+		stream.push(packet)
+	}
+}
+
+// accept 处理对端打开的流
+func (t *streamTable) accept(packet *Packet) {
+	h := packet.Header
+
+	t.mu.Lock()
+	if t.err != nil || t.remote >= maxConcurrentStreams || t.streams[h.Stream] != nil {
+		t.mu.Unlock()
+		t.reset(h.Stream, h.Type)
+		return
+	}
+	stream := newStream(t, context.Background(), h.Stream, h.Type)
+	t.streams[h.Stream] = stream
+	t.remote++
+	onOpen := t.onOpen
+	t.mu.Unlock()
+
+	if onOpen != nil && onOpen(stream) {
+		return
+	}
+	if stream.ptype == PacketTypeChannel {
+		select {
+		case t.backlog <- stream:
+			return
+		default:
+		}
+	}
+	stream.abort(ErrStreamRefused)
+	t.reset(h.Stream, h.Type)
+}
+
+// reset 通知对端取消流
+func (t *streamTable) reset(id uint32, ptype PacketType) {
+	packet := NewPacket(ptype, nil, 0)
+	packet.Header.Stream = id
+	packet.Header.Flags = flagStreamReset
+	t.conn.SendPacket(packet)
+}
+
+// remove 移除流
+func (t *streamTable) remove(id uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.streams[id]; !ok {
+		return
+	}
+	delete(t.streams, id)
+	if id%2 != t.nextID%2 {
+		t.remote--
+	}
+}
+
+// hold 记录占用内存预算的流, 调用方需持有stream.mu
+func (t *streamTable) hold(stream *Stream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.holding == nil {
+		t.holding = make(map[*Stream]struct{})
+	}
+	t.holding[stream] = struct{}{}
+}
+
+// unhold 流不再占用内存预算, 调用方需持有stream.mu
+func (t *streamTable) unhold(stream *Stream) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.holding, stream)
+}
+
+// closeAll 连接断开时结束所有流, 并释放所有流缓冲的数据占用的内存预算
+func (t *streamTable) closeAll(err error) {
+	t.mu.Lock()
+	if t.err == nil {
+		t.err = err
+	}
+	streams := make([]*Stream, 0, len(t.streams))
+	for _, stream := range t.streams {
+		streams = append(streams, stream)
+	}
+	holding := make([]*Stream, 0, len(t.holding))
+	for stream := range t.holding {
+		holding = append(holding, stream)
+	}
+	t.mu.Unlock()
+
+	for _, stream := range streams {
+		stream.abort(err)
+	}
+	for _, stream := range holding {
+		stream.uncharge()
+	}
+}
+
+// OpenStream 在连接上打开一条流, ctx取消时流被重置
+func (c *Client) OpenStream(ctx context.Context, packetType PacketType) (*Stream, error) {
+	conn, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+	return conn.streams.open(ctx, packetType)
+}
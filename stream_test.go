@@ -0,0 +1,265 @@
+package snet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// echoStream 原样返回收到的每条消息
+func echoStream(stream *Stream) {
+	for {
+		packet, err := stream.Recv()
+		if err != nil {
+			return
+		}
+		if err := stream.Send(packet.Data); err != nil {
+			return
+		}
+	}
+}
+
+func TestStreamMessageLargerThanWindow(t *testing.T) {
+	s := NewServer("")
+	s.AddStreamHandlerFunc(PacketTypeVideo, echoStream)
+	c := dialClient(t, startServer(t, s))
+
+	stream, err := c.OpenStream(context.Background(), PacketTypeVideo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := bytes.Repeat([]byte("0123456789abcdef"), 4*streamWindowSize/16)
+	for range 3 {
+		if err := stream.Send(msg); err != nil {
+			t.Fatal(err)
+		}
+		packet, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(packet.Data, msg) {
+			t.Fatalf("got %d bytes, want %d", len(packet.Data), len(msg))
+		}
+	}
+}
+
+func TestStreamCreditOnRecv(t *testing.T) {
+	const (
+		size  = streamFrameSize
+		count = 64
+	)
+	var sent atomic.Int32
+	s := NewServer("")
+	s.AddStreamHandlerFunc(PacketTypeVideo, func(stream *Stream) {
+		msg := make([]byte, size)
+		for i := range count {
+			msg[0] = byte(i)
+			if err := stream.Send(msg); err != nil {
+				return
+			}
+			sent.Add(1)
+		}
+	})
+	c := dialClient(t, startServer(t, s))
+
+	stream, err := c.OpenStream(context.Background(), PacketTypeVideo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 不读取时发送方在接收窗口耗尽后阻塞
+	window := int32(streamWindowSize / size)
+	waitFor(t, "window to fill", func() bool { return sent.Load() >= window })
+	time.Sleep(50 * time.Millisecond)
+	if n := sent.Load(); n > window+1 {
+		t.Fatalf("sent %d messages without reads, window allows %d", n, window)
+	}
+	stream.mu.Lock()
+	buffered := stream.buffered
+	stream.mu.Unlock()
+	if buffered > streamWindowSize+streamFrameSize {
+		t.Fatalf("buffered %d bytes, want at most one window", buffered)
+	}
+
+	for i := range count {
+		packet, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if packet.Data[0] != byte(i) {
+			t.Fatalf("message %d out of order", i)
+		}
+	}
+}
+
+func TestStreamFragmentsHeldUntilRecv(t *testing.T) {
+	var sent atomic.Int32
+	s := NewServer("")
+	s.AddStreamHandlerFunc(PacketTypeVideo, func(stream *Stream) {
+		msg := make([]byte, 2*streamWindowSize)
+		for range 4 {
+			if err := stream.Send(msg); err != nil {
+				return
+			}
+			sent.Add(1)
+		}
+	})
+	c := dialClient(t, startServer(t, s))
+
+	stream, err := c.OpenStream(context.Background(), PacketTypeVideo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未调用Recv时分片不释放窗口, 超过窗口的消息无法发送完
+	time.Sleep(100 * time.Millisecond)
+	stream.mu.Lock()
+	buffered, pending := stream.buffered, stream.partialCredit
+	stream.mu.Unlock()
+	if sent.Load() != 0 || buffered > streamWindowSize+streamFrameSize {
+		t.Fatalf("sent %d messages, buffered %d bytes before any Recv", sent.Load(), buffered)
+	}
+	if pending != buffered {
+		t.Fatalf("partial credit %d, want %d", pending, buffered)
+	}
+
+	for i := range 4 {
+		packet, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if len(packet.Data) != 2*streamWindowSize {
+			t.Fatalf("message %d: got %d bytes", i, len(packet.Data))
+		}
+	}
+}
+
+func TestStreamServerStreaming(t *testing.T) {
+	s := NewServer("")
+	s.AddStreamHandlerFunc(PacketTypeVideo, func(stream *Stream) {
+		for i := range 3 {
+			if err := stream.Send([]byte{byte(i)}); err != nil {
+				return
+			}
+		}
+	})
+	c := dialClient(t, startServer(t, s))
+
+	stream, err := c.OpenStream(context.Background(), PacketTypeVideo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		packet, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packet.Header.Type != PacketTypeVideo || packet.Data[0] != byte(i) {
+			t.Fatalf("message %d: type %d data %v", i, packet.Header.Type, packet.Data)
+		}
+	}
+	// 处理器返回后发送方向关闭
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatalf("Recv after handler returned: %v, want io.EOF", err)
+	}
+}
+
+func TestStreamBidirectional(t *testing.T) {
+	s := NewServer("")
+	s.AddStreamHandlerFunc(PacketTypeAudio, func(stream *Stream) {
+		total := 0
+		for {
+			packet, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return
+			}
+			total += len(packet.Data)
+			stream.Send(packet.Data)
+		}
+		stream.SendPacket(PacketTypeAck, []byte(strconv.Itoa(total)))
+	})
+	c := dialClient(t, startServer(t, s))
+
+	stream, err := c.OpenStream(context.Background(), PacketTypeAudio)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"a", "bc", "def"} {
+		if err := stream.Send([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		packet, err := stream.Recv()
+		if err != nil || string(packet.Data) != msg {
+			t.Fatalf("echo of %q: %v %v", msg, packet, err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send([]byte("late")); err != ErrStreamClosed {
+		t.Fatalf("Send after CloseSend: %v", err)
+	}
+	packet, err := stream.Recv()
+	if err != nil || packet.Header.Type != PacketTypeAck || string(packet.Data) != "6" {
+		t.Fatalf("summary: %v %v", packet, err)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatalf("Recv after summary: %v, want io.EOF", err)
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	serverErr := make(chan error, 1)
+	s := NewServer("")
+	s.AddStreamHandlerFunc(PacketTypeVideo, func(stream *Stream) {
+		_, err := stream.Recv()
+		serverErr <- err
+	})
+	c := dialClient(t, startServer(t, s))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := c.OpenStream(ctx, PacketTypeVideo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := stream.Recv(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("local Recv after cancel: %v", err)
+	}
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, ErrStreamReset) {
+			t.Fatalf("remote Recv after cancel: %v, want ErrStreamReset", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler not notified of cancel")
+	}
+	if err := stream.Send([]byte("x")); err == nil {
+		t.Fatal("Send on canceled stream succeeded")
+	}
+}
+
+func TestStreamWithoutHandlerReset(t *testing.T) {
+	s := NewServer("")
+	s.AddHandlerFunc(PacketTypeChat, func(conn *Conn, packet *Packet) {})
+	c := dialClient(t, startServer(t, s))
+
+	stream, err := c.OpenStream(context.Background(), PacketTypeVideo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); !errors.Is(err, ErrStreamReset) {
+		t.Fatalf("Recv on refused stream: %v, want ErrStreamReset", err)
+	}
+	select {
+	case <-stream.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream context not done")
+	}
+}
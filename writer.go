@@ -0,0 +1,305 @@
+package snet
+
+import (
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy 发送队列已满时的处理方式
+type OverflowPolicy uint8
+
+const (
+	OverflowBlock  OverflowPolicy = iota // 等待队列空出, 最多等待写超时时间
+	OverflowReject                       // 立即返回ErrSendQueueFull
+)
+
+// AsyncWriteConfig 异步发送配置
+//
+// 启用后SendPacket只负责编码并放入发送队列, 由每个连接独立的写协程批量写出.
+// 入队成功即返回nil; 写出失败时连接被关闭, 之后的SendPacket返回该错误.
+// 连接关闭时会尝试写出队列中剩余的数据包.
+type AsyncWriteConfig struct {
+	QueueSize  int            // 每个优先级的队列容量(包数), 默认1024
+	MaxBatch   int            // 单次写出的最大包数, 默认64
+	FlushDelay time.Duration  // 凑批的最长等待时间, 0表示有数据立即写出
+	Overflow   OverflowPolicy // 队列已满时的处理方式
+}
+
+// withDefaults 填充默认值
+func (cfg AsyncWriteConfig) withDefaults() AsyncWriteConfig {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	if cfg.MaxBatch <= 0 {
+		cfg.MaxBatch = 64
+	}
+	return cfg
+}
+
+// asyncWriter 连接的异步写协程
+type asyncWriter struct {
+	conn   *Conn
+	cfg    AsyncWriteConfig
+	queues [numPriorities]chan []byte
+	done   chan struct{} // 写协程退出时关闭
+
+	mu  sync.Mutex
+	err error
+}
+
+func newAsyncWriter(conn *Conn, cfg AsyncWriteConfig) *asyncWriter {
+	cfg = cfg.withDefaults()
+	w := &asyncWriter{
+		conn: conn,
+		cfg:  cfg,
+		done: make(chan struct{}),
+	}
+	for p := range w.queues {
+		w.queues[p] = make(chan []byte, cfg.QueueSize)
+	}
+	return w
+}
+
+// failure 写出失败的原因
+func (w *asyncWriter) failure() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// enqueue 将编码后的数据包放入对应优先级的队列
+func (w *asyncWriter) enqueue(priority Priority, data []byte) error {
+	if err := w.failure(); err != nil {
+		return err
+	}
+	select {
+	case <-w.conn.closed:
+		return ErrConnClosed
+	default:
+	}
+
+	queue := w.queues[priority]
+	select {
+	case queue <- data:
+		return nil
+	default:
+	}
+	if w.cfg.Overflow == OverflowReject {
+		return ErrSendQueueFull
+	}
+
+	var expired <-chan time.Time
+	if w.conn.writeTimeout > 0 {
+		timer := time.NewTimer(w.conn.writeTimeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case queue <- data:
+		return nil
+	case <-expired:
+		return ErrSendQueueFull
+	case <-w.conn.closed:
+		return ErrConnClosed
+	case <-w.done:
+		if err := w.failure(); err != nil {
+			return err
+		}
+		return ErrConnClosed
+	}
+}
+
+// offer 在timeout内将数据包放入队列, dropOldest为true时队列满则丢弃最旧的数据包
+func (w *asyncWriter) offer(priority Priority, data []byte, timeout time.Duration, dropOldest bool) (dropped bool, err error) {
+	if err := w.failure(); err != nil {
+		return false, err
+	}
+	queue := w.queues[priority]
+	select {
+	case queue <- data:
+		return false, nil
+	default:
+	}
+
+	if dropOldest {
+		select {
+		case <-queue:
+			dropped = true
+		default:
+		}
+		select {
+		case queue <- data:
+			return dropped, nil
+		default:
+			return dropped, ErrSendQueueFull
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case queue <- data:
+		return false, nil
+	case <-timer.C:
+		return false, ErrSendQueueFull
+	case <-w.conn.closed:
+		return false, ErrConnClosed
+	case <-w.done:
+		return false, ErrConnClosed
+	}
+}
+
+// poll 按优先级非阻塞地取出一个数据包
+func (w *asyncWriter) poll() ([]byte, bool) {
+	for _, queue := range w.queues {
+		select {
+		case data := <-queue:
+			return data, true
+		default:
+		}
+	}
+	return nil, false
+}
+
+// wait 阻塞等待数据包, 连接关闭或超时返回false
+func (w *asyncWriter) wait(expired <-chan time.Time) ([]byte, bool) {
+	select {
+	case data := <-w.queues[PriorityControl]:
+		return data, true
+	case data := <-w.queues[PriorityInteractive]:
+		return data, true
+	case data := <-w.queues[PriorityBulk]:
+		return data, true
+	case <-expired:
+		return nil, false
+	case <-w.conn.closed:
+		return nil, false
+	}
+}
+
+// run 写协程: 聚合队列中的数据包后一次写出
+func (w *asyncWriter) run() {
+	defer close(w.done)
+
+	batch := make([][]byte, 0, w.cfg.MaxBatch)
+	for {
+		data, ok := w.poll()
+		if !ok {
+			if data, ok = w.wait(nil); !ok {
+				w.drain(batch)
+				return
+			}
+		}
+		batch = append(batch, data)
+		batch = w.fill(batch)
+
+		if err := w.write(batch); err != nil {
+			w.fail(err)
+			return
+		}
+		clear(batch)
+		batch = batch[:0]
+	}
+}
+
+// fill 在MaxBatch和FlushDelay限制内继续收集数据包
+func (w *asyncWriter) fill(batch [][]byte) [][]byte {
+	var expired <-chan time.Time
+	for len(batch) < w.cfg.MaxBatch {
+		if data, ok := w.poll(); ok {
+			batch = append(batch, data)
+			continue
+		}
+		if w.cfg.FlushDelay <= 0 {
+			break
+		}
+		if expired == nil {
+			timer := time.NewTimer(w.cfg.FlushDelay)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		data, ok := w.wait(expired)
+		if !ok {
+			break
+		}
+		batch = append(batch, data)
+	}
+	return batch
+}
+
+// drain 连接关闭时写出剩余的数据包
+func (w *asyncWriter) drain(batch [][]byte) {
+	for {
+		data, ok := w.poll()
+		if !ok {
+			break
+		}
+		batch = append(batch, data)
+	}
+	if len(batch) > 0 {
+		w.write(batch)
+	}
+}
+
+// write 一次写出整批数据, TCP连接使用writev, 其他连接合并后写出.
+// 写出成功后才计入发送指标
+func (w *asyncWriter) write(batch [][]byte) error {
+	if w.conn.writeTimeout > 0 {
+		w.conn.Conn.SetWriteDeadline(time.Now().Add(w.conn.writeTimeout))
+	}
+
+	var err error
+	if _, ok := w.conn.Conn.(*net.TCPConn); ok {
+		// WriteTo会清空已写出的元素, 使用副本以便之后按batch计入指标
+		buffers := net.Buffers(slices.Clone(batch))
+		_, err = buffers.WriteTo(w.conn.Conn)
+	} else {
+		buf := GetBytesBuffer()
+		for _, data := range batch {
+			buf.Write(data)
+		}
+		_, err = w.conn.Conn.Write(buf.Bytes())
+		PutBytesBuffer(buf)
+	}
+	if err != nil {
+		return err
+	}
+	for _, data := range batch {
+		w.conn.metrics.sent(data)
+	}
+	return nil
+}
+
+// fail 记录写出错误并关闭底层连接, 读循环随之退出
+func (w *asyncWriter) fail(err error) {
+	w.mu.Lock()
+	first := w.err == nil
+	if first {
+		w.err = err
+	}
+	w.mu.Unlock()
+	if first {
+		w.conn.logger.Warn("write failed", slog.Any("error", err))
+	}
+	w.conn.setCloseReason(CloseNetworkError)
+	w.conn.Conn.Close()
+}
+
+// SetAsyncWrite 为之后建立的连接启用异步批量发送
+func (s *Server) SetAsyncWrite(cfg AsyncWriteConfig) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.asyncWrite = &cfg
+	return s
+}
+
+// SetAsyncWrite 为之后建立的连接启用异步批量发送
+func (c *Client) SetAsyncWrite(cfg AsyncWriteConfig) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.asyncWrite = &cfg
+	return c
+}
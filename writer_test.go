@@ -0,0 +1,217 @@
+package snet
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordConn 记录每次写出的net.Conn, gate非nil时写出前等待放行
+type recordConn struct {
+	net.Conn
+	gate    chan struct{}
+	err     error
+	pending atomic.Int32 // 进入Write的次数
+
+	mu     sync.Mutex
+	writes [][]byte
+	closed bool
+}
+
+func (c *recordConn) Write(b []byte) (int, error) {
+	c.pending.Add(1)
+	if c.gate != nil {
+		<-c.gate
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes = append(c.writes, bytes.Clone(b))
+	return len(b), nil
+}
+
+func (c *recordConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *recordConn) SetWriteDeadline(time.Time) error { return nil }
+func (c *recordConn) SetReadDeadline(time.Time) error  { return nil }
+
+// written 写出次数和写出的数据包数
+func (c *recordConn) written() (writes, packets int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, w := range c.writes {
+		packets += len(w) / (HeaderSize + 1)
+	}
+	return len(c.writes), packets
+}
+
+// asyncConn 以rc为底层连接并启用异步发送的连接
+func asyncConn(rc *recordConn, cfg AsyncWriteConfig) *Conn {
+	conn := newConn(rc)
+	conn.startAsyncWriter(cfg)
+	return conn
+}
+
+// send 发送一个1字节数据的数据包
+func send(conn *Conn, packetType PacketType) error {
+	return conn.SendPacket(NewPacket(packetType, []byte{1}, 0))
+}
+
+func TestAsyncWriterBatches(t *testing.T) {
+	rc := &recordConn{}
+	conn := asyncConn(rc, AsyncWriteConfig{FlushDelay: 50 * time.Millisecond})
+	defer conn.Close()
+
+	for range 5 {
+		if err := send(conn, PacketTypeChat); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "packets written", func() bool { _, n := rc.written(); return n == 5 })
+	if writes, _ := rc.written(); writes != 1 {
+		t.Fatalf("5 packets written in %d writes, want 1", writes)
+	}
+}
+
+func TestAsyncWriterDrainsOnClose(t *testing.T) {
+	rc := &recordConn{gate: make(chan struct{})}
+	conn := asyncConn(rc, AsyncWriteConfig{})
+	for range 3 {
+		if err := send(conn, PacketTypeChat); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		conn.Close()
+		close(closed)
+	}()
+	// 写出完成前Close不返回
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the queue was drained")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(rc.gate)
+	<-closed
+	if _, n := rc.written(); n != 3 {
+		t.Fatalf("%d packets written before close, want 3", n)
+	}
+	if err := send(conn, PacketTypeChat); !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("send after close: %v", err)
+	}
+}
+
+func TestAsyncWriterFailure(t *testing.T) {
+	errBroken := errors.New("broken pipe")
+	rc := &recordConn{err: errBroken}
+	conn := asyncConn(rc, AsyncWriteConfig{})
+	defer conn.Close()
+
+	if err := send(conn, PacketTypeChat); err != nil {
+		t.Fatalf("enqueue before the failure is seen: %v", err)
+	}
+	// 写出失败后关闭底层连接
+	waitFor(t, "writer to fail", func() bool {
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		return rc.closed
+	})
+	if err := send(conn, PacketTypeChat); !errors.Is(err, errBroken) {
+		t.Fatalf("send after failure: %v, want %v", err, errBroken)
+	}
+	if conn.CloseReason() != CloseNetworkError {
+		t.Fatalf("close reason %v", conn.CloseReason())
+	}
+}
+
+func TestAsyncWriterOverflow(t *testing.T) {
+	for _, overflow := range []OverflowPolicy{OverflowReject, OverflowBlock} {
+		rc := &recordConn{gate: make(chan struct{})}
+		conn := asyncConn(rc, AsyncWriteConfig{QueueSize: 1, Overflow: overflow})
+		conn.SetTimeout(0, 20*time.Millisecond)
+
+		// 第一个包阻塞在写出上, 第二个占满队列
+		send(conn, PacketTypeChat)
+		waitFor(t, "writer to block", func() bool { return rc.pending.Load() == 1 })
+		if err := send(conn, PacketTypeChat); err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		if err := send(conn, PacketTypeChat); !errors.Is(err, ErrSendQueueFull) {
+			t.Fatalf("overflow %d: send to a full queue: %v", overflow, err)
+		}
+		if overflow == OverflowBlock && time.Since(start) < 20*time.Millisecond {
+			t.Fatal("OverflowBlock returned before the write timeout")
+		}
+		// 其他优先级的队列不受影响
+		if err := send(conn, PacketTypeHeartbeat); err != nil {
+			t.Fatal(err)
+		}
+		close(rc.gate)
+		conn.Close()
+	}
+}
+
+// tcpPair 本机回环上的一对TCP连接, 用于覆盖writev写出
+func tcpPair(t *testing.T) (local, remote net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+	local, err = net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote = <-accepted
+	if remote == nil {
+		t.Fatal("accept failed")
+	}
+	t.Cleanup(func() {
+		local.Close()
+		remote.Close()
+	})
+	return local, remote
+}
+
+func TestAsyncWriterTCP(t *testing.T) {
+	local, remote := tcpPair(t)
+	conn := newConn(local)
+	conn.startAsyncWriter(AsyncWriteConfig{FlushDelay: 20 * time.Millisecond})
+	defer conn.Close()
+
+	for i := range 5 {
+		if err := conn.SendPacket(NewPacket(PacketTypeChat, []byte{byte(i)}, uint32(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remote.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := range 5 {
+		packet, err := (&defaultDecoder{}).decode(remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packet.Header.Seq != uint32(i) || packet.Data[0] != byte(i) {
+			t.Fatalf("packet %d: seq %d data %v", i, packet.Header.Seq, packet.Data)
+		}
+	}
+}